@@ -13,7 +13,7 @@ cat .goreleaser.demo.yaml | ARCH=$ARCH envsubst > .goreleaser.demo.$ARCH.yaml
 VERSION=$VERSION goreleaser release -f .goreleaser.demo.$ARCH.yaml --snapshot --rm-dist
 
 # create a new kind cluster and connect to it
-kind get clusters | grep $PROJECT || kind create cluster --name $PROJECT --image=kindest/node:v1.23.4
+kind get clusters | grep $PROJECT || kind create cluster --name $PROJECT --image=kindest/node:v1.24.0
 kind get kubeconfig --name $PROJECT > ./dist/kubeconfig
 
 # load the demo images
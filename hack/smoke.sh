@@ -0,0 +1,26 @@
+#!/usr/bin/env bash
+
+# Smoke test the demo created by hack/demo.sh, by making a single call from the example client
+# to the example server. The exit status of the call command is passed on.
+
+set -euo pipefail
+
+export KUBECONFIG=./dist/kubeconfig
+
+kubectl rollout status -n example-server deployment/example-server --timeout=5m
+kubectl rollout status -n example-client deployment/example-client --timeout=5m
+
+client_args=(
+  "--server-address=example-server.example-server.svc.cluster.local:9090"
+  "--server-spiffe-id=spiffe://demo.jetstack.net/ns/example-server/sa/example-server"
+  "--tls-cert-file=/var/run/secrets/spiffe.io/tls.crt"
+  "--tls-key-file=/var/run/secrets/spiffe.io/tls.key"
+  "--trusted-ca-file=/var/run/secrets/spiffe.io/ca.crt"
+  "--log-level=warn"
+)
+
+for rpc in hello whoami; do
+  echo "calling $rpc"
+  kubectl exec -n example-client deployment/example-client -- \
+    /spiffe-demo-client "${client_args[@]}" call --rpc "$rpc" --output json
+done
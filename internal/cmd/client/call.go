@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/go-kit/log/level"
+	"github.com/urfave/cli/v2"
+	"google.golang.org/protobuf/encoding/protojson"
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/jetstack/spiffe-demo/internal/pkg/client"
+	"github.com/jetstack/spiffe-demo/internal/pkg/server/proto"
+)
+
+// Exit codes of the call command, so that probes and scripts can tell why a call failed. Invalid
+// flags or config exit with 1, like every other command.
+const (
+	exitConnectionFailed = 2
+	exitServerIdentity   = 3
+	exitPermissionDenied = 4
+	exitCallFailed       = 5
+)
+
+// Call makes a single call to the server, prints the response and exits with a status describing
+// whether it succeeded.
+func Call(ctx *cli.Context) error {
+	rpc := ctx.String("rpc")
+	if rpc != "hello" && rpc != "whoami" {
+		return cli.Exit(fmt.Sprintf("--rpc must be hello or whoami, not %q", rpc), 1)
+	}
+	output := ctx.String("output")
+	if output != "text" && output != "json" {
+		return cli.Exit(fmt.Sprintf("--output must be text or json, not %q", output), 1)
+	}
+
+	logger, stop, err := start(ctx)
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	policy, err := retryPolicy()
+	if err != nil {
+		return err
+	}
+	conn, err := connect(ctx, logger)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	demoClient := proto.NewSpiffeDemoClient(conn)
+
+	callCtx, cancel := context.WithTimeout(ctx.Context, policy.Timeout)
+	defer cancel()
+	var (
+		method string
+		resp   protobuf.Message
+	)
+	if rpc == "whoami" {
+		method = "/SpiffeDemo/WhoAmI"
+		resp, err = demoClient.WhoAmI(callCtx, &emptypb.Empty{})
+	} else {
+		method = "/SpiffeDemo/HelloWorld"
+		resp, err = demoClient.HelloWorld(callCtx, &emptypb.Empty{})
+	}
+	if err != nil {
+		reason := client.ClassifyFailure(err)
+		return cli.Exit(fmt.Sprintf("%s failed: %s (%s)", method, reason, err.Error()), exitCode(reason))
+	}
+	level.Debug(logger).Log("msg", "call succeeded", "method", method)
+
+	if output == "json" {
+		out, err := protojson.MarshalOptions{Multiline: true}.Marshal(resp)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+	switch resp := resp.(type) {
+	case *proto.WhoAmIResponse:
+		return printIdentity(os.Stdout, resp)
+	case *proto.HelloWorldResponse:
+		fmt.Println(resp.Message)
+	}
+	return nil
+}
+
+// exitCode returns the exit status of a call that failed for reason.
+func exitCode(reason client.FailureReason) int {
+	switch reason {
+	case client.FailureUnavailable, client.FailureTLS, client.FailureTimeout:
+		return exitConnectionFailed
+	case client.FailureServerIdentity:
+		return exitServerIdentity
+	case client.FailurePermissionDenied:
+		return exitPermissionDenied
+	default:
+		return exitCallFailed
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/jetstack/spiffe-demo/internal/pkg/client"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := map[client.FailureReason]int{
+		client.FailureUnavailable:      exitConnectionFailed,
+		client.FailureTLS:              exitConnectionFailed,
+		client.FailureTimeout:          exitConnectionFailed,
+		client.FailureServerIdentity:   exitServerIdentity,
+		client.FailurePermissionDenied: exitPermissionDenied,
+		client.FailureRateLimited:      exitCallFailed,
+		client.FailureOther:            exitCallFailed,
+	}
+	for reason, want := range tests {
+		t.Run(string(reason), func(t *testing.T) {
+			if got := exitCode(reason); got != want {
+				t.Errorf("expected exit code %d, got %d", want, got)
+			}
+		})
+	}
+}
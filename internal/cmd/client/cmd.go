@@ -3,22 +3,260 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
+	"io"
+	"os"
+	"strings"
 	"time"
 
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
 	"github.com/spiffe/go-spiffe/v2/spiffegrpc/grpccredentials"
-	"github.com/spiffe/go-spiffe/v2/spiffeid"
-	"github.com/spiffe/go-spiffe/v2/spiffetls/tlsconfig"
 	"github.com/urfave/cli/v2"
 	"google.golang.org/grpc"
 	"google.golang.org/protobuf/types/known/emptypb"
 
+	"github.com/jetstack/spiffe-demo/internal/pkg/client"
 	"github.com/jetstack/spiffe-demo/internal/pkg/config"
+	"github.com/jetstack/spiffe-demo/internal/pkg/logging"
+	"github.com/jetstack/spiffe-demo/internal/pkg/metrics"
 	"github.com/jetstack/spiffe-demo/internal/pkg/server/proto"
+	"github.com/jetstack/spiffe-demo/internal/pkg/tracing"
 	"github.com/jetstack/spiffe-demo/types"
 )
 
 func Run(ctx *cli.Context) error {
+	logger, stop, err := start(ctx)
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	policy, err := retryPolicy()
+	if err != nil {
+		return err
+	}
+	conn, err := connect(ctx, logger)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	demoClient := proto.NewSpiffeDemoClient(conn)
+
+	failures := 0
+	wait := policy.Interval
+	for {
+		select {
+		case <-ctx.Context.Done():
+			level.Info(logger).Log("msg", "client stopped")
+			return nil
+		case <-time.After(wait):
+		}
+
+		callCtx, cancel := context.WithTimeout(ctx.Context, policy.Timeout)
+		resp, err := demoClient.HelloWorld(callCtx, &emptypb.Empty{})
+		cancel()
+		if err != nil {
+			if ctx.Context.Err() != nil {
+				level.Info(logger).Log("msg", "client stopped")
+				return nil
+			}
+			failures++
+			logCallFailure(logger, "/SpiffeDemo/HelloWorld", failures, err)
+			if policy.MaxConsecutiveFailures > 0 && failures >= policy.MaxConsecutiveFailures {
+				return cli.Exit(fmt.Sprintf("Giving up after %d consecutive failed calls (%s)", failures, err.Error()), 1)
+			}
+			wait = policy.Backoff(failures)
+			continue
+		}
+
+		if failures > 0 {
+			level.Info(logger).Log("msg", "call succeeded after failures", "failures", failures)
+		}
+		failures, wait = 0, policy.Interval
+		level.Info(logger).Log("msg", "got message", "message", resp.Message)
+	}
+}
+
+// logCallFailure logs why a call failed. Failures that may go away by themselves, such as TLS
+// errors while SVIDs are rotated, are logged as warnings and authorization failures as errors.
+func logCallFailure(logger log.Logger, method string, failures int, err error) {
+	reason := client.ClassifyFailure(err)
+	logLevel := level.Error
+	if reason.Transient() {
+		logLevel = level.Warn
+	}
+	logLevel(logger).Log("msg", "call failed", "method", method, "reason", reason, "transient", reason.Transient(), "consecutive_failures", failures, "error", err)
+}
+
+// retryPolicy returns the client's retry policy from the current config.
+func retryPolicy() (*client.RetryPolicy, error) {
+	var cfg *types.RetryConfig
+	if clientConfig := config.GetCurrentConfig().Client; clientConfig != nil {
+		cfg = clientConfig.Retry
+	}
+	policy, err := client.NewRetryPolicy(cfg)
+	if err != nil {
+		return nil, cli.Exit(fmt.Sprintf("Invalid retry policy (%s)", err.Error()), 1)
+	}
+	return policy, nil
+}
+
+// start sets up logging, the config and tracing for any of the client's commands. The returned
+// function must be called before exiting, to flush spans and stop watching files.
+func start(ctx *cli.Context) (log.Logger, func(), error) {
+	logger, err := newLogger(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := loadConfig(ctx, logger); err != nil {
+		return nil, nil, err
+	}
+	shutdownTracing, err := tracing.Setup(ctx.Context, "spiffe-demo-client", config.GetCurrentConfig().Tracing)
+	if err != nil {
+		config.GetCurrentSource().Cancel()
+		return nil, nil, cli.Exit(fmt.Sprintf("Couldn't set up tracing (%s)", err.Error()), 1)
+	}
+
+	stop := func() {
+		// ctx is already cancelled when exiting, so give the exporter a little longer to flush.
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(shutdownCtx); err != nil {
+			level.Error(logger).Log("msg", "failed to flush spans", "error", err)
+		}
+		// The current source may have been replaced by a config reload by the time we exit.
+		config.GetCurrentSource().Cancel()
+	}
+	return logger, stop, nil
+}
+
+// connect dials the server, which must present an SVID accepted by the client's server authorization.
+func connect(ctx *cli.Context, logger log.Logger) (clientConn, error) {
+	svid, err := config.CurrentSource.GetX509SVID()
+	if err != nil {
+		return nil, cli.Exit(fmt.Sprintf("Couldn't determine SPIFFE ID (%s)", err.Error()), 1)
+	}
+	level.Info(logger).Log("msg", "starting client", "spiffe_id", svid.ID)
+
+	clientConfig := config.GetCurrentConfig().Client
+	serverAuthorization := serverAuthorizationFromFlags(ctx)
+	if clientConfig != nil && !emptyServerAuthorization(clientConfig.ServerAuthorization) {
+		serverAuthorization = clientConfig.ServerAuthorization
+	}
+	serverAddress := ctx.String("server-address")
+	level.Info(logger).Log(
+		"msg", "expecting server", "address", serverAddress,
+		"server_ids", strings.Join(serverAuthorization.IDs, ","),
+		"server_trust_domains", strings.Join(serverAuthorization.TrustDomains, ","),
+		"server_path_prefixes", strings.Join(serverAuthorization.PathPrefixes, ","),
+		"server_id_regex", serverAuthorization.Regex,
+	)
+
+	if emptyServerAuthorization(serverAuthorization) {
+		return nil, cli.Exit("At least one of --server-spiffe-id, --server-trust-domain, --server-path-prefix or --server-id-regex is required", 1)
+	}
+	serverAuthorizer, err := client.NewServerAuthorizer(serverAuthorization)
+	if err != nil {
+		return nil, cli.Exit(fmt.Sprintf("Invalid server authorization (%s)", err.Error()), 1)
+	}
+	authorizer := config.AuthorizeNotDenied(config.AuthorizeUnrevoked(serverAuthorizer))
+	policy, err := retryPolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	rpcMetrics := serveMetrics(ctx, logger)
+	dialOpts := []grpc.DialOption{
+		grpc.WithDefaultServiceConfig(policy.ServiceConfig()),
+		grpc.WithChainUnaryInterceptor(client.TracingInterceptors()...),
+		grpc.WithChainUnaryInterceptor(client.MetricsInterceptor(rpcMetrics)),
+		grpc.WithChainStreamInterceptor(client.StreamTracingInterceptors()...),
+		grpc.WithChainStreamInterceptor(client.StreamMetricsInterceptor(rpcMetrics)),
+	}
+	if clientConfig != nil && clientConfig.Authentication.Mode == types.AuthModeJWT {
+		audience := clientConfig.Authentication.JWTAudience
+		if len(audience) == 0 {
+			if len(serverAuthorization.IDs) != 1 {
+				return nil, cli.Exit("--jwt-audience is required unless exactly one --server-spiffe-id is given", 1)
+			}
+			audience = serverAuthorization.IDs[0]
+		}
+		level.Info(logger).Log("msg", "authenticating with JWT-SVIDs", "audience", audience)
+		dialOpts = append(dialOpts,
+			grpc.WithTransportCredentials(grpccredentials.TLSClientCredentials(config.CurrentSource, authorizer)),
+			grpc.WithPerRPCCredentials(client.JWTSVIDCredentials{Source: config.CurrentSource, Audience: audience}),
+		)
+	} else {
+		dialOpts = append(dialOpts, grpc.WithTransportCredentials(
+			grpccredentials.MTLSClientCredentials(config.CurrentSource, config.CurrentSource, authorizer),
+		))
+	}
+	dial := func() (*grpc.ClientConn, error) {
+		conn, err := grpc.DialContext(ctx.Context, serverAddress, dialOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("credentialmanager: while attempting to connect to server: %w", err)
+		}
+		return conn, nil
+	}
+	if clientConfig != nil && clientConfig.ReconnectOnRotation {
+		conn, err := client.NewReconnectingConn(ctx.Context, logger, config.CurrentSource, client.DefaultRotationCheckInterval, dial)
+		if err != nil {
+			return nil, err
+		}
+		return conn, nil
+	}
+	return dial()
+}
+
+// clientConn is a *grpc.ClientConn, or a *client.ReconnectingConn if we reconnect when our SVID is rotated.
+type clientConn interface {
+	grpc.ClientConnInterface
+	io.Closer
+}
+
+// serverAuthorizationFromFlags returns the servers accepted by the --server-spiffe-id,
+// --server-trust-domain, --server-path-prefix and --server-id-regex flags.
+func serverAuthorizationFromFlags(ctx *cli.Context) types.ServerAuthorization {
+	return types.ServerAuthorization{
+		IDs:          ctx.StringSlice("server-spiffe-id"),
+		TrustDomains: ctx.StringSlice("server-trust-domain"),
+		PathPrefixes: ctx.StringSlice("server-path-prefix"),
+		Regex:        ctx.String("server-id-regex"),
+	}
+}
+
+func emptyServerAuthorization(a types.ServerAuthorization) bool {
+	return len(a.IDs) == 0 && len(a.TrustDomains) == 0 && len(a.PathPrefixes) == 0 && len(a.Regex) == 0
+}
+
+// loadConfig sets the current config and source, either from the config file if one was provided
+// (in which case it is watched for changes), or from the individual flags.
+func loadConfig(ctx *cli.Context, logger log.Logger) error {
+	if path := ctx.String("config"); len(path) > 0 {
+		if _, err := config.WatchConfigFile(ctx.Context, logger, path); err != nil {
+			return cli.Exit(fmt.Sprintf("Couldn't load config file %s (%s)", path, err.Error()), 1)
+		}
+		return nil
+	}
+
+	cfg, err := configFromFlags(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Set up X509 SVID Source
+	x509SourceCtx, x509SourceCancel := context.WithCancel(ctx.Context)
+	source, err := config.ConstructSpiffeDemoSource(x509SourceCtx, x509SourceCancel, logger, cfg.SPIFFE)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Couldn't get SPIFFE ID from workload API or files (%s)", err.Error()), 1)
+	}
+	config.StoreConfig(cfg)
+	config.StoreCurrentSource(source)
+	return nil
+}
+
+// configFromFlags builds the equivalent of a config file from the individual flags.
+func configFromFlags(ctx *cli.Context) (*types.ConfigFile, error) {
 	cfg := &types.SpiffeConfig{}
 	if len(ctx.String("workload-api-socket")) > 0 {
 		cfg.SVIDSources.WorkloadAPI = &types.WorkloadAPI{
@@ -27,71 +265,89 @@ func Run(ctx *cli.Context) error {
 	} else {
 		cert, key := ctx.String("tls-cert-file"), ctx.String("tls-key-file")
 		if len(cert) == 0 || len(key) == 0 {
-			return cli.Exit(
-				fmt.Sprintf("Either --workload-api-socket or both --tls-cert-file and --tls-key-file must be set"),
+			return nil, cli.Exit(
+				fmt.Sprintf("Either --config, --workload-api-socket or both --tls-cert-file and --tls-key-file must be set"),
 				1,
 			)
 		}
 		ca := ctx.String("trusted-ca-file")
 		if len(ca) == 0 {
-			return cli.Exit(
+			return nil, cli.Exit(
 				fmt.Sprintf("--trusted-ca-file is required"), 1,
 			)
 		}
 		cfg.SVIDSources.Files = &types.Files{
+			TrustDomain:   ctx.String("trust-domain"),
 			TrustDomainCA: ca,
 			SVIDCert:      cert,
 			SVIDKey:       key,
+			JWTSVID:       ctx.String("jwt-svid-file"),
+			JWTBundle:     ctx.String("jwt-bundle-file"),
+			CRLs:          ctx.StringSlice("crl-file"),
 		}
 	}
 
-	// Set up X509 SVID Source
-	x509SourceCtx, x509SourceCancel := context.WithCancel(ctx.Context)
-	source, err := config.ConstructSpiffeDemoSource(x509SourceCtx, x509SourceCancel, cfg)
-	if err != nil {
-		return cli.Exit(fmt.Sprintf("Couldn't get SPIFFE ID from workload API or files (%s)", err.Error()), 1)
-	}
-	config.StoreCurrentSource(source)
+	cfg.DenyList = ctx.String("deny-list-file")
 
-	svid, err := source.GetX509SVID()
+	authMode, err := config.NormaliseAuthMode(ctx.String("auth-mode"))
 	if err != nil {
-		return cli.Exit(fmt.Sprintf("Couldn't determine SPIFFE ID (%s)", err.Error()), 1)
+		return nil, cli.Exit(fmt.Sprintf("Invalid --auth-mode (%s)", err.Error()), 1)
 	}
-	log.Println("starting client ", svid.ID.String())
 
-	serverSPIFFEID := ctx.String("server-spiffe-id")
-	serverAddress := ctx.String("server-address")
-	log.Println("expecting server with ID", serverSPIFFEID)
+	return &types.ConfigFile{
+		SPIFFE: cfg,
+		Metrics: &types.MetricsConfig{
+			ListenAddress: ctx.String("metrics-address"),
+			PeerIDLabel:   ctx.Bool("metrics-peer-id-label"),
+		},
+		Tracing: &types.TracingConfig{
+			Exporter:     ctx.String("trace-exporter"),
+			OTLPEndpoint: ctx.String("otlp-endpoint"),
+			OTLPInsecure: ctx.Bool("otlp-insecure"),
+		},
+		Client: &types.ClientConfig{
+			Authentication: types.ClientAuthentication{
+				Mode:        authMode,
+				JWTAudience: ctx.String("jwt-audience"),
+			},
+			ServerAuthorization: serverAuthorizationFromFlags(ctx),
+			ReconnectOnRotation: ctx.Bool("reconnect-on-rotation"),
+			Retry: &types.RetryConfig{
+				Interval:               ctx.Duration("request-interval"),
+				Timeout:                ctx.Duration("request-timeout"),
+				MaxAttempts:            ctx.Int("max-attempts"),
+				InitialBackoff:         ctx.Duration("initial-backoff"),
+				MaxBackoff:             ctx.Duration("max-backoff"),
+				BackoffMultiplier:      ctx.Float64("backoff-multiplier"),
+				MaxConsecutiveFailures: ctx.Int("max-consecutive-failures"),
+			},
+		},
+	}, nil
+}
 
-	var authorizer tlsconfig.Authorizer
-	id, err := spiffeid.FromString(serverSPIFFEID)
-	if err != nil {
-		return fmt.Errorf("provided SPIFFE ID is invalid: %w", err)
+// serveMetrics starts serving metrics in the background if configured, and returns the
+// RPC metrics to record calls in, which is nil if metrics are disabled.
+func serveMetrics(ctx *cli.Context, logger log.Logger) *metrics.RPCMetrics {
+	metricsConfig := config.GetCurrentConfig().Metrics
+	if metricsConfig == nil || len(metricsConfig.ListenAddress) == 0 {
+		return nil
 	}
-	authorizer = tlsconfig.AuthorizeID(id)
-	conn, err := grpc.DialContext(
-		ctx.Context,
-		serverAddress,
-		grpc.WithTransportCredentials(
-			grpccredentials.MTLSClientCredentials(config.CurrentSource, config.CurrentSource, authorizer),
-		),
-	)
-	if err != nil {
-		return fmt.Errorf("credentialmanager: while attempting to connect to server: %w", err)
-	}
-	client := proto.NewSpiffeDemoClient(conn)
-
-	for {
-		time.Sleep(time.Second)
-
-		connCtx, cancel := context.WithTimeout(ctx.Context, time.Minute)
-		resp, err := client.HelloWorld(connCtx, &emptypb.Empty{})
-		cancel()
-		if err != nil {
-			log.Println(err)
-			continue
+	metrics.Register()
+	go func() {
+		if err := metrics.Serve(ctx.Context, logger, metricsConfig.ListenAddress); err != nil {
+			level.Error(logger).Log("msg", "metrics server failed", "error", err)
 		}
+	}()
+	return metrics.NewRPCMetrics("client", metricsConfig.PeerIDLabel)
+}
 
-		log.Println("got message:", resp.Message)
+// newLogger builds a logger from the --log-format and --log-level flags, which apply even when
+// a config file is used, and sends anything logged with the standard library logger to it.
+func newLogger(ctx *cli.Context) (log.Logger, error) {
+	logger, err := logging.New(os.Stderr, ctx.String("log-format"), ctx.String("log-level"))
+	if err != nil {
+		return nil, cli.Exit(err.Error(), 1)
 	}
+	logging.RedirectStdlib(logger)
+	return logger, nil
 }
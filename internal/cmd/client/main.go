@@ -1,30 +1,221 @@
 package main
 
 import (
+	"context"
+	"log"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/urfave/cli/v2"
+
+	"github.com/jetstack/spiffe-demo/internal/pkg/client"
+	"github.com/jetstack/spiffe-demo/internal/pkg/logging"
 )
 
 func main() {
 	app := &cli.App{
 		Usage:     "SVID to external credential client",
 		ArgsUsage: "",
-		Commands:  nil,
+		Commands: []*cli.Command{
+			{
+				Name:   "whoami",
+				Usage:  "Print our identity as verified by the server, including the certificate chain",
+				Action: WhoAmI,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "output",
+						Aliases:  []string{"o"},
+						Usage:    "Output format, text or json",
+						Required: false,
+						Hidden:   false,
+						Value:    "text",
+					},
+				},
+			},
+			{
+				Name:   "call",
+				Usage:  "Make a single call to the server and print the response. Exits with 2 if the server couldn't be reached, 3 if its SPIFFE ID wasn't accepted, 4 if the call was denied and 5 if it failed otherwise",
+				Action: Call,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "rpc",
+						Usage:    "RPC to call, hello or whoami",
+						Required: false,
+						Hidden:   false,
+						Value:    "hello",
+					},
+					&cli.StringFlag{
+						Name:     "output",
+						Aliases:  []string{"o"},
+						Usage:    "Output format, text or json",
+						Required: false,
+						Hidden:   false,
+						Value:    "text",
+					},
+				},
+			},
+			{
+				Name:   "watch",
+				Usage:  "Keep a stream open to the server, reporting when either end's certificate changes",
+				Action: Watch,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "rpc",
+						Usage:    "Streaming RPC to call, heartbeat or chat",
+						Required: false,
+						Hidden:   false,
+						Value:    "heartbeat",
+					},
+					&cli.DurationFlag{
+						Name:     "interval",
+						Usage:    "Interval between heartbeats or chat messages",
+						Required: false,
+						Hidden:   false,
+						Value:    5 * time.Second,
+					},
+				},
+			},
+		},
 		Flags: []cli.Flag{
 			&cli.StringFlag{
 				Name:     "server-address",
 				Aliases:  []string{"s"},
-				Usage:    "address / port to connect to the SPIFFE connector server",
+				Usage:    "address / port to connect to the SPIFFE connector server, or unix:///path/to/socket",
 				Required: false,
 				Hidden:   false,
 				Value:    "localhost:9090",
 			},
-			&cli.StringFlag{
+			&cli.StringSliceFlag{
 				Name:     "server-spiffe-id",
 				Aliases:  []string{"sid"},
-				Usage:    "Expected SPIFFE ID of the SPIFFE connector server",
-				Required: true,
+				Usage:    "Expected SPIFFE ID of the SPIFFE connector server. May be repeated to accept any of several servers",
+				Required: false,
+				Hidden:   false,
+			},
+			&cli.StringSliceFlag{
+				Name:     "server-trust-domain",
+				Usage:    "Trust domain the server's SPIFFE ID must be a member of. May be repeated",
+				Required: false,
+				Hidden:   false,
+			},
+			&cli.StringSliceFlag{
+				Name:     "server-path-prefix",
+				Usage:    "Prefix the path of the server's SPIFFE ID must start with, such as /ns/example-server/. May be repeated",
+				Required: false,
+				Hidden:   false,
+			},
+			&cli.StringFlag{
+				Name:     "server-id-regex",
+				Usage:    "Regular expression the server's whole SPIFFE ID must match",
+				Required: false,
+				Hidden:   false,
+			},
+			&cli.StringFlag{
+				Name:      "config",
+				Aliases:   []string{"c"},
+				Usage:     "Path to a config file, which is watched for changes and takes precedence over all other flags",
+				Required:  false,
+				Hidden:    false,
+				TakesFile: true,
+			},
+			&cli.BoolFlag{
+				Name:     "reconnect-on-rotation",
+				Usage:    "Reconnect to the server whenever our X509-SVID changes, so that it sees the new certificate straight away",
+				Required: false,
+				Hidden:   false,
+			},
+			&cli.DurationFlag{
+				Name:     "request-interval",
+				Usage:    "Interval between successful calls",
+				Required: false,
+				Hidden:   false,
+				Value:    client.DefaultRequestInterval,
+			},
+			&cli.DurationFlag{
+				Name:     "request-timeout",
+				Usage:    "Timeout of each call, including all of its attempts",
+				Required: false,
+				Hidden:   false,
+				Value:    client.DefaultRequestTimeout,
+			},
+			&cli.IntFlag{
+				Name:     "max-attempts",
+				Usage:    "Number of times a call is attempted while the server is unavailable, at most 5. 1 disables retries",
+				Required: false,
+				Hidden:   false,
+				Value:    client.DefaultMaxAttempts,
+			},
+			&cli.DurationFlag{
+				Name:     "initial-backoff",
+				Usage:    "Backoff before the first retry, and before the next call after a failed call",
+				Required: false,
+				Hidden:   false,
+				Value:    client.DefaultInitialBackoff,
+			},
+			&cli.DurationFlag{
+				Name:     "max-backoff",
+				Usage:    "Longest backoff between attempts and between failed calls",
+				Required: false,
+				Hidden:   false,
+				Value:    client.DefaultMaxBackoff,
+			},
+			&cli.Float64Flag{
+				Name:     "backoff-multiplier",
+				Usage:    "Factor the backoff grows by after every failure",
+				Required: false,
+				Hidden:   false,
+				Value:    client.DefaultBackoffMultiplier,
+			},
+			&cli.IntFlag{
+				Name:     "max-consecutive-failures",
+				Usage:    "Exit with a non-zero status after this many calls in a row have failed, so that the client is restarted. 0 never gives up",
+				Required: false,
+				Hidden:   false,
+			},
+			&cli.StringFlag{
+				Name:     "log-level",
+				Usage:    "Lowest level of messages to log: debug, info, warn or error",
+				Required: false,
+				Hidden:   false,
+				Value:    "info",
+			},
+			&cli.StringFlag{
+				Name:     "log-format",
+				Usage:    "Format of log messages: logfmt or json",
+				Required: false,
+				Hidden:   false,
+				Value:    logging.FormatLogfmt,
+			},
+			&cli.StringFlag{
+				Name:     "metrics-address",
+				Usage:    "Address to serve Prometheus metrics on at /metrics, such as :9402. Metrics are disabled if unset",
+				Required: false,
+				Hidden:   false,
+			},
+			&cli.BoolFlag{
+				Name:     "metrics-peer-id-label",
+				Usage:    "Label RPC metrics with the full SPIFFE ID of the peer, which creates a series per peer",
+				Required: false,
+				Hidden:   false,
+			},
+			&cli.StringFlag{
+				Name:     "trace-exporter",
+				Usage:    "Export OpenTelemetry spans to 'stdout' or 'otlp'. Tracing is disabled if unset",
+				Required: false,
+				Hidden:   false,
+			},
+			&cli.StringFlag{
+				Name:     "otlp-endpoint",
+				Usage:    "host:port of the OpenTelemetry collector for the otlp trace exporter",
+				Required: false,
+				Hidden:   false,
+			},
+			&cli.BoolFlag{
+				Name:     "otlp-insecure",
+				Usage:    "Connect to the OpenTelemetry collector without TLS",
+				Required: false,
 				Hidden:   false,
 			},
 			&cli.StringFlag{
@@ -59,9 +250,62 @@ func main() {
 				Hidden:    false,
 				TakesFile: true,
 			},
+			&cli.StringFlag{
+				Name:      "deny-list-file",
+				Usage:     "Path to a YAML file of SPIFFE IDs and path prefixes to reject, which is reloaded whenever it changes",
+				Required:  false,
+				Hidden:    false,
+				TakesFile: true,
+			},
+			&cli.StringSliceFlag{
+				Name:      "crl-file",
+				Usage:     "Path to a CRL issued by a CA of the trust domain, listing revoked certificates. May be repeated",
+				Required:  false,
+				Hidden:    false,
+				TakesFile: true,
+			},
+			&cli.StringFlag{
+				Name:     "trust-domain",
+				Usage:    "Trust domain of the CAs in --trusted-ca-file, defaults to the trust domain of the SVID",
+				Required: false,
+				Hidden:   false,
+			},
+			&cli.StringFlag{
+				Name:      "jwt-svid-file",
+				Usage:     "Path to JWT-SVID token file",
+				Required:  false,
+				Hidden:    false,
+				TakesFile: true,
+			},
+			&cli.StringFlag{
+				Name:      "jwt-bundle-file",
+				Usage:     "Path to JWKS containing the JWT authorities of the trust domain",
+				Required:  false,
+				Hidden:    false,
+				TakesFile: true,
+			},
+			&cli.StringFlag{
+				Name:     "auth-mode",
+				Usage:    "How to authenticate to the server, either with our X509-SVID (mtls) or with a JWT-SVID bearer token (jwt)",
+				Required: false,
+				Hidden:   false,
+				Value:    "mtls",
+			},
+			&cli.StringFlag{
+				Name:     "jwt-audience",
+				Usage:    "Audience to request JWT-SVIDs for when --auth-mode=jwt, defaults to --server-spiffe-id",
+				Required: false,
+				Hidden:   false,
+			},
 		},
 		Action:                 Run,
 		UseShortOptionHandling: false,
 	}
-	app.Run(os.Args)
+
+	// Cancel on SIGTERM so that Kubernetes can shut us down gracefully
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	if err := app.RunContext(ctx, os.Args); err != nil {
+		log.Fatal(err)
+	}
 }
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/spiffe/go-spiffe/v2/spiffegrpc/grpccredentials"
+	"github.com/urfave/cli/v2"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/jetstack/spiffe-demo/internal/pkg/config"
+	"github.com/jetstack/spiffe-demo/internal/pkg/identity"
+	"github.com/jetstack/spiffe-demo/internal/pkg/server/proto"
+)
+
+// Watch keeps a Heartbeat or Chat stream open to the server, reopening it whenever it ends, and
+// reports when either end's certificate changes.
+func Watch(ctx *cli.Context) error {
+	rpc := ctx.String("rpc")
+	if rpc != "heartbeat" && rpc != "chat" {
+		return cli.Exit(fmt.Sprintf("--rpc must be heartbeat or chat, not %q", rpc), 1)
+	}
+	interval := ctx.Duration("interval")
+
+	logger, stop, err := start(ctx)
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	conn, err := connect(ctx, logger)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	demoClient := proto.NewSpiffeDemoClient(conn)
+
+	tracker := &certificateTracker{logger: logger}
+	for {
+		if rpc == "heartbeat" {
+			err = heartbeat(ctx.Context, logger, demoClient, interval, tracker)
+		} else {
+			err = chat(ctx.Context, logger, demoClient, interval, tracker)
+		}
+		if ctx.Context.Err() != nil {
+			level.Info(logger).Log("msg", "client stopped")
+			return nil
+		}
+		level.Warn(logger).Log("msg", "stream ended, reopening", "rpc", rpc, "error", err)
+
+		select {
+		case <-ctx.Context.Done():
+			level.Info(logger).Log("msg", "client stopped")
+			return nil
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func heartbeat(ctx context.Context, logger log.Logger, demoClient proto.SpiffeDemoClient, interval time.Duration, tracker *certificateTracker) error {
+	stream, err := demoClient.Heartbeat(ctx, &proto.HeartbeatRequest{Interval: durationpb.New(interval)})
+	if err != nil {
+		return err
+	}
+	tracker.opened(stream.Context())
+
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		level.Info(logger).Log("msg", "heartbeat", "sequence", resp.Sequence, "server_serial", resp.ServerSVIDSerial, "client_serial", resp.ClientSVIDSerial)
+		tracker.received(resp.ServerSVIDSerial, resp.ClientSVIDSerial)
+	}
+}
+
+func chat(ctx context.Context, logger log.Logger, demoClient proto.SpiffeDemoClient, interval time.Duration, tracker *certificateTracker) error {
+	stream, err := demoClient.Chat(ctx)
+	if err != nil {
+		return err
+	}
+	tracker.opened(stream.Context())
+	serverSerial := identity.PeerSerialFromContext(stream.Context())
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for n := 1; ; n++ {
+		err := stream.Send(&proto.ChatMessage{
+			Text:             fmt.Sprintf("message %d", n),
+			Time:             timestamppb.Now(),
+			SenderSVIDSerial: identity.SVIDSerial(config.CurrentSource),
+			PeerSVIDSerial:   serverSerial,
+		})
+		// Send only returns io.EOF when the stream has failed, the reason is returned by Recv.
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		reply, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		level.Info(logger).Log("msg", "chat reply", "text", reply.Text, "server_serial", reply.SenderSVIDSerial, "client_serial", reply.PeerSVIDSerial)
+		tracker.received(reply.SenderSVIDSerial, reply.PeerSVIDSerial)
+
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// certificateTracker reports changes to the certificates presented on each stream, and to the
+// SVIDs each end currently has, which differ once an SVID is rotated during a long-lived connection.
+type certificateTracker struct {
+	logger log.Logger
+	// serverSerial is the serial of the certificate the server presented on the latest stream
+	serverSerial string
+	// reported is the last pair of current SVID serials a rotation was reported for
+	reported [2]string
+}
+
+// opened records the certificate the server presented for a new stream.
+func (t *certificateTracker) opened(ctx context.Context) {
+	cert, ok := identity.PeerCertificateFromContext(ctx)
+	if !ok {
+		return
+	}
+	serverID, _ := grpccredentials.PeerIDFromContext(ctx)
+	serial := identity.SerialString(cert)
+	switch {
+	case len(t.serverSerial) == 0:
+		level.Info(t.logger).Log("msg", "stream opened", "server_id", serverID, "server_serial", serial, "not_after", cert.NotAfter)
+	case serial != t.serverSerial:
+		level.Info(t.logger).Log("msg", "server certificate changed", "server_id", serverID, "previous_serial", t.serverSerial, "server_serial", serial, "not_after", cert.NotAfter)
+	default:
+		level.Info(t.logger).Log("msg", "stream reopened with the same server certificate", "server_id", serverID, "server_serial", serial)
+	}
+	t.serverSerial = serial
+}
+
+// received compares the serials reported in a message with the certificates presented on the connection.
+func (t *certificateTracker) received(serverCurrent, clientPresented string) {
+	clientCurrent := identity.SVIDSerial(config.CurrentSource)
+	if [2]string{serverCurrent, clientCurrent} == t.reported {
+		return
+	}
+	if len(serverCurrent) > 0 && serverCurrent != t.serverSerial {
+		level.Info(t.logger).Log("msg", "server has rotated its SVID since the connection was opened", "presented_serial", t.serverSerial, "current_serial", serverCurrent)
+	}
+	if len(clientPresented) > 0 && clientPresented != clientCurrent {
+		level.Info(t.logger).Log("msg", "client has rotated its SVID since the connection was opened", "presented_serial", clientPresented, "current_serial", clientCurrent)
+	}
+	t.reported = [2]string{serverCurrent, clientCurrent}
+}
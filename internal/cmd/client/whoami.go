@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/jetstack/spiffe-demo/internal/pkg/server/proto"
+)
+
+// WhoAmI asks the server how it sees us, and prints the answer.
+func WhoAmI(ctx *cli.Context) error {
+	output := ctx.String("output")
+	if output != "text" && output != "json" {
+		return cli.Exit(fmt.Sprintf("--output must be text or json, not %q", output), 1)
+	}
+
+	logger, stop, err := start(ctx)
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	conn, err := connect(ctx, logger)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	callCtx, cancel := context.WithTimeout(ctx.Context, 30*time.Second)
+	defer cancel()
+	resp, err := proto.NewSpiffeDemoClient(conn).WhoAmI(callCtx, &emptypb.Empty{})
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("WhoAmI failed (%s)", err.Error()), 1)
+	}
+
+	if output == "json" {
+		out, err := protojson.MarshalOptions{Multiline: true}.Marshal(resp)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+	return printIdentity(os.Stdout, resp)
+}
+
+func printIdentity(out io.Writer, resp *proto.WhoAmIResponse) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "SPIFFE ID:\t%s\n", resp.SPIFFEID)
+	fmt.Fprintf(w, "Trust domain:\t%s\n", resp.TrustDomain)
+	fmt.Fprintf(w, "Path segments:\t%s\n", strings.Join(resp.PathSegments, ", "))
+	fmt.Fprintf(w, "Authenticated with:\t%s\n", resp.AuthenticationMode)
+	if len(resp.CertificateSerial) > 0 {
+		fmt.Fprintf(w, "Certificate serial:\t%s\n", resp.CertificateSerial)
+		fmt.Fprintf(w, "Not before:\t%s\n", resp.NotBefore.AsTime().Format(time.RFC3339))
+		notAfter := resp.NotAfter.AsTime()
+		fmt.Fprintf(w, "Not after:\t%s (in %s)\n", notAfter.Format(time.RFC3339), time.Until(notAfter).Round(time.Second))
+	}
+	fmt.Fprintf(w, "Server SPIFFE ID:\t%s\n", resp.ServerSPIFFEID)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(resp.VerifiedChain) > 0 {
+		fmt.Fprintln(out, "Verified chain:")
+		for i, cert := range resp.VerifiedChain {
+			fmt.Fprintf(out, "  %d: subject=%q issuer=%q serial=%s\n", i, cert.Subject, cert.Issuer, cert.Serial)
+		}
+	}
+	return nil
+}
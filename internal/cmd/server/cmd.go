@@ -3,16 +3,111 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
+	"os"
+	"time"
 
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
 	"github.com/urfave/cli/v2"
 
 	"github.com/jetstack/spiffe-demo/internal/pkg/config"
+	"github.com/jetstack/spiffe-demo/internal/pkg/logging"
+	"github.com/jetstack/spiffe-demo/internal/pkg/metrics"
 	"github.com/jetstack/spiffe-demo/internal/pkg/server"
+	"github.com/jetstack/spiffe-demo/internal/pkg/tracing"
 	"github.com/jetstack/spiffe-demo/types"
 )
 
 func Run(ctx *cli.Context) error {
+	logger, err := newLogger(ctx)
+	if err != nil {
+		return err
+	}
+	if err := loadConfig(ctx, logger); err != nil {
+		return err
+	}
+	// The current source may have been replaced by a config reload by the time we exit.
+	defer func() {
+		config.GetCurrentSource().Cancel()
+	}()
+
+	shutdownTracing, err := tracing.Setup(ctx.Context, "spiffe-demo-server", config.GetCurrentConfig().Tracing)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Couldn't set up tracing (%s)", err.Error()), 1)
+	}
+	defer func() {
+		// ctx is already cancelled when exiting, so give the exporter a little longer to flush.
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(shutdownCtx); err != nil {
+			level.Error(logger).Log("msg", "failed to flush spans", "error", err)
+		}
+	}()
+
+	svid, err := config.CurrentSource.GetX509SVID()
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Couldn't determine SPIFFE ID (%s)", err.Error()), 1)
+	}
+
+	level.Info(logger).Log("msg", "starting server", "spiffe_id", svid.ID)
+
+	s := &server.Server{
+		Logger: logger,
+	}
+	s.RPCMetrics, s.RateLimitMetrics = serveMetrics(ctx, logger, s)
+	if serverConfig := config.GetCurrentConfig().Server; serverConfig != nil && serverConfig.Audit != nil {
+		auditLog, err := server.OpenAuditLog(serverConfig.Audit)
+		if err != nil {
+			return cli.Exit(fmt.Sprintf("Couldn't open audit log (%s)", err.Error()), 1)
+		}
+		defer auditLog.Close()
+		s.AuditLog = auditLog
+		level.Info(logger).Log("msg", "writing audit log", "file", serverConfig.Audit.Path)
+	}
+	if err := s.LoadPolicy(config.GetCurrentConfig()); err != nil {
+		return cli.Exit(err.Error(), 1)
+	}
+	config.AddReloadHook(s.PreparePolicy)
+	if err := s.LoadRateLimits(config.GetCurrentConfig()); err != nil {
+		return cli.Exit(err.Error(), 1)
+	}
+	config.AddReloadHook(s.PrepareRateLimits)
+
+	if err := s.Start(ctx.Context); err != nil {
+		return cli.Exit(fmt.Sprintf("Server failed (%s)", err.Error()), 1)
+	}
+	level.Info(logger).Log("msg", "server stopped")
+	return nil
+}
+
+// loadConfig sets the current config and source, either from the config file if one was provided
+// (in which case it is watched for changes), or from the individual flags.
+func loadConfig(ctx *cli.Context, logger log.Logger) error {
+	if path := ctx.String("config"); len(path) > 0 {
+		if _, err := config.WatchConfigFile(ctx.Context, logger, path); err != nil {
+			return cli.Exit(fmt.Sprintf("Couldn't load config file %s (%s)", path, err.Error()), 1)
+		}
+		return nil
+	}
+
+	cfg, err := configFromFlags(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Set up X509 SVID Source
+	x509SourceCtx, x509SourceCancel := context.WithCancel(ctx.Context)
+	source, err := config.ConstructSpiffeDemoSource(x509SourceCtx, x509SourceCancel, logger, cfg.SPIFFE)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Couldn't get SPIFFE ID from workload API or files (%s)", err.Error()), 1)
+	}
+	config.StoreConfig(cfg)
+	config.StoreCurrentSource(source)
+	return nil
+}
+
+// configFromFlags builds the equivalent of a config file from the individual flags.
+func configFromFlags(ctx *cli.Context) (*types.ConfigFile, error) {
 	cfg := &types.SpiffeConfig{}
 	if len(ctx.String("workload-api-socket")) > 0 {
 		cfg.SVIDSources.WorkloadAPI = &types.WorkloadAPI{
@@ -21,41 +116,106 @@ func Run(ctx *cli.Context) error {
 	} else {
 		cert, key := ctx.String("tls-cert-file"), ctx.String("tls-key-file")
 		if len(cert) == 0 || len(key) == 0 {
-			return cli.Exit(
-				fmt.Sprintf("Either --workload-api-socket or both --tls-cert-file and --tls-key-file must be set"),
+			return nil, cli.Exit(
+				fmt.Sprintf("Either --config, --workload-api-socket or both --tls-cert-file and --tls-key-file must be set"),
 				1,
 			)
 		}
 		ca := ctx.String("trusted-ca-file")
 		if len(ca) == 0 {
-			return cli.Exit(
+			return nil, cli.Exit(
 				fmt.Sprintf("--trusted-ca-file is required"), 1,
 			)
 		}
 		cfg.SVIDSources.Files = &types.Files{
+			TrustDomain:   ctx.String("trust-domain"),
 			TrustDomainCA: ca,
 			SVIDCert:      cert,
 			SVIDKey:       key,
+			JWTSVID:       ctx.String("jwt-svid-file"),
+			JWTBundle:     ctx.String("jwt-bundle-file"),
+			CRLs:          ctx.StringSlice("crl-file"),
 		}
 	}
 
-	// Set up X509 SVID Source
-	x509SourceCtx, x509SourceCancel := context.WithCancel(ctx.Context)
-	source, err := config.ConstructSpiffeDemoSource(x509SourceCtx, x509SourceCancel, cfg)
-	if err != nil {
-		return cli.Exit(fmt.Sprintf("Couldn't get SPIFFE ID from workload API or files (%s)", err.Error()), 1)
+	var listeners []types.Listener
+	for _, address := range ctx.StringSlice("listen-address") {
+		listeners = append(listeners, types.Listener{
+			Address:    address,
+			SocketMode: ctx.String("socket-mode"),
+		})
+	}
+
+	var audit *types.AuditConfig
+	if path := ctx.String("audit-log"); len(path) > 0 {
+		audit = &types.AuditConfig{
+			Path:       path,
+			MaxSizeMB:  ctx.Int("audit-log-max-size"),
+			MaxBackups: ctx.Int("audit-log-max-backups"),
+		}
 	}
-	config.StoreCurrentSource(source)
 
-	svid, err := source.GetX509SVID()
+	cfg.DenyList = ctx.String("deny-list-file")
+
+	authMode, err := config.NormaliseAuthMode(ctx.String("auth-mode"))
 	if err != nil {
-		return cli.Exit(fmt.Sprintf("Couldn't determine SPIFFE ID (%s)", err.Error()), 1)
+		return nil, cli.Exit(fmt.Sprintf("Invalid --auth-mode (%s)", err.Error()), 1)
 	}
 
-	log.Println("starting server for ", svid.ID.String())
+	return &types.ConfigFile{
+		SPIFFE: cfg,
+		Metrics: &types.MetricsConfig{
+			ListenAddress: ctx.String("metrics-address"),
+			PeerIDLabel:   ctx.Bool("metrics-peer-id-label"),
+		},
+		Tracing: &types.TracingConfig{
+			Exporter:     ctx.String("trace-exporter"),
+			OTLPEndpoint: ctx.String("otlp-endpoint"),
+			OTLPInsecure: ctx.Bool("otlp-insecure"),
+		},
+		Server: &types.ServerConfig{
+			Listeners:           listeners,
+			HealthListenAddress: ctx.String("health-listen-address"),
+			Authentication: types.ServerAuthentication{
+				Mode:         authMode,
+				JWTAudiences: ctx.StringSlice("jwt-audience"),
+			},
+			DrainTimeout:             ctx.Duration("drain-timeout"),
+			RevalidateOnBundleChange: ctx.Bool("revalidate-on-bundle-change"),
+			Audit:                    audit,
+			Keepalive: &types.KeepaliveConfig{
+				Time:                  ctx.Duration("keepalive-time"),
+				Timeout:               ctx.Duration("keepalive-timeout"),
+				MaxConnectionAge:      ctx.Duration("max-connection-age"),
+				MaxConnectionAgeGrace: ctx.Duration("max-connection-age-grace"),
+			},
+		},
+	}, nil
+}
 
-	s := &server.Server{}
+// serveMetrics starts serving metrics in the background if configured, and returns the
+// metrics for s to record calls and rate limiting in, which are nil if metrics are disabled.
+func serveMetrics(ctx *cli.Context, logger log.Logger, s *server.Server) (*metrics.RPCMetrics, *metrics.RateLimitMetrics) {
+	metricsConfig := config.GetCurrentConfig().Metrics
+	if metricsConfig == nil || len(metricsConfig.ListenAddress) == 0 {
+		return nil, nil
+	}
+	metrics.Register()
+	go func() {
+		if err := metrics.Serve(ctx.Context, logger, metricsConfig.ListenAddress); err != nil {
+			level.Error(logger).Log("msg", "metrics server failed", "error", err)
+		}
+	}()
+	return metrics.NewRPCMetrics("server", metricsConfig.PeerIDLabel), metrics.NewRateLimitMetrics(metricsConfig.PeerIDLabel, s)
+}
 
-	s.Start(ctx.Context)
-	return nil
+// newLogger builds a logger from the --log-format and --log-level flags, which apply even when
+// a config file is used, and sends anything logged with the standard library logger to it.
+func newLogger(ctx *cli.Context) (log.Logger, error) {
+	logger, err := logging.New(os.Stderr, ctx.String("log-format"), ctx.String("log-level"))
+	if err != nil {
+		return nil, cli.Exit(err.Error(), 1)
+	}
+	logging.RedirectStdlib(logger)
+	return logger, nil
 }
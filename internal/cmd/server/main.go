@@ -1,9 +1,16 @@
 package main
 
 import (
+	"context"
+	"log"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/urfave/cli/v2"
+
+	"github.com/jetstack/spiffe-demo/internal/pkg/logging"
+	"github.com/jetstack/spiffe-demo/internal/pkg/server"
 )
 
 func main() {
@@ -12,6 +19,79 @@ func main() {
 		ArgsUsage: "",
 		Commands:  nil,
 		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:      "config",
+				Aliases:   []string{"c"},
+				Usage:     "Path to a config file, which is watched for changes and takes precedence over all other flags",
+				Required:  false,
+				Hidden:    false,
+				TakesFile: true,
+			},
+			&cli.StringSliceFlag{
+				Name:     "listen-address",
+				Aliases:  []string{"l"},
+				Usage:    "Address to listen on, either host:port or unix:///path/to/socket. May be repeated to listen on several addresses",
+				Required: false,
+				Hidden:   false,
+				Value:    cli.NewStringSlice(server.DefaultListenAddress),
+			},
+			&cli.StringFlag{
+				Name:     "socket-mode",
+				Usage:    "Octal file mode of Unix domain sockets given in --listen-address",
+				Required: false,
+				Hidden:   false,
+				Value:    server.DefaultSocketMode,
+			},
+			&cli.StringFlag{
+				Name:     "health-listen-address",
+				Usage:    "Optional address to serve only the gRPC health service on without TLS, for Kubernetes probes",
+				Required: false,
+				Hidden:   false,
+			},
+			&cli.StringFlag{
+				Name:     "log-level",
+				Usage:    "Lowest level of messages to log: debug, info, warn or error",
+				Required: false,
+				Hidden:   false,
+				Value:    "info",
+			},
+			&cli.StringFlag{
+				Name:     "log-format",
+				Usage:    "Format of log messages: logfmt or json",
+				Required: false,
+				Hidden:   false,
+				Value:    logging.FormatLogfmt,
+			},
+			&cli.StringFlag{
+				Name:     "metrics-address",
+				Usage:    "Address to serve Prometheus metrics on at /metrics, such as :9402. Metrics are disabled if unset",
+				Required: false,
+				Hidden:   false,
+			},
+			&cli.BoolFlag{
+				Name:     "metrics-peer-id-label",
+				Usage:    "Label RPC metrics with the full SPIFFE ID of the peer, which creates a series per peer",
+				Required: false,
+				Hidden:   false,
+			},
+			&cli.StringFlag{
+				Name:     "trace-exporter",
+				Usage:    "Export OpenTelemetry spans to 'stdout' or 'otlp'. Tracing is disabled if unset",
+				Required: false,
+				Hidden:   false,
+			},
+			&cli.StringFlag{
+				Name:     "otlp-endpoint",
+				Usage:    "host:port of the OpenTelemetry collector for the otlp trace exporter",
+				Required: false,
+				Hidden:   false,
+			},
+			&cli.BoolFlag{
+				Name:     "otlp-insecure",
+				Usage:    "Connect to the OpenTelemetry collector without TLS",
+				Required: false,
+				Hidden:   false,
+			},
 			&cli.StringFlag{
 				Name:      "workload-api-socket",
 				Aliases:   []string{"w"},
@@ -44,9 +124,118 @@ func main() {
 				Hidden:    false,
 				TakesFile: true,
 			},
+			&cli.StringFlag{
+				Name:      "deny-list-file",
+				Usage:     "Path to a YAML file of SPIFFE IDs and path prefixes to reject, which is reloaded whenever it changes",
+				Required:  false,
+				Hidden:    false,
+				TakesFile: true,
+			},
+			&cli.StringSliceFlag{
+				Name:      "crl-file",
+				Usage:     "Path to a CRL issued by a CA of the trust domain, listing revoked certificates. May be repeated. Not checked for callers using --auth-mode=jwt",
+				Required:  false,
+				Hidden:    false,
+				TakesFile: true,
+			},
+			&cli.StringFlag{
+				Name:     "trust-domain",
+				Usage:    "Trust domain of the CAs in --trusted-ca-file, defaults to the trust domain of the SVID",
+				Required: false,
+				Hidden:   false,
+			},
+			&cli.StringFlag{
+				Name:      "jwt-svid-file",
+				Usage:     "Path to JWT-SVID token file",
+				Required:  false,
+				Hidden:    false,
+				TakesFile: true,
+			},
+			&cli.StringFlag{
+				Name:      "jwt-bundle-file",
+				Usage:     "Path to JWKS containing the JWT authorities of the trust domain",
+				Required:  false,
+				Hidden:    false,
+				TakesFile: true,
+			},
+			&cli.StringFlag{
+				Name:     "auth-mode",
+				Usage:    "How clients authenticate, either with their X509-SVID (mtls) or with a JWT-SVID bearer token (jwt)",
+				Required: false,
+				Hidden:   false,
+				Value:    "mtls",
+			},
+			&cli.StringSliceFlag{
+				Name:     "jwt-audience",
+				Usage:    "Audiences accepted in JWT-SVIDs when --auth-mode=jwt, defaults to the server's SPIFFE ID",
+				Required: false,
+				Hidden:   false,
+			},
+			&cli.DurationFlag{
+				Name:     "drain-timeout",
+				Usage:    "How long in-flight calls are given to finish on shutdown",
+				Required: false,
+				Hidden:   false,
+				Value:    server.DefaultDrainTimeout,
+			},
+			&cli.BoolFlag{
+				Name:     "revalidate-on-bundle-change",
+				Usage:    "Re-verify clients on open connections whenever a trust bundle or CRL is reloaded, closing those that are no longer trusted",
+				Required: false,
+				Hidden:   false,
+			},
+			&cli.DurationFlag{
+				Name:     "keepalive-time",
+				Usage:    "How long a connection is idle for before pinging the client, defaults to 2h",
+				Required: false,
+				Hidden:   false,
+			},
+			&cli.DurationFlag{
+				Name:     "keepalive-timeout",
+				Usage:    "How long to wait for a ping to be acknowledged before closing the connection, defaults to 20s",
+				Required: false,
+				Hidden:   false,
+			},
+			&cli.DurationFlag{
+				Name:     "max-connection-age",
+				Usage:    "How long a connection may be open before the client is asked to reconnect, so that both ends present their current SVIDs. Unlimited if unset",
+				Required: false,
+				Hidden:   false,
+			},
+			&cli.DurationFlag{
+				Name:     "max-connection-age-grace",
+				Usage:    "How long calls are given to finish once a connection reaches --max-connection-age, before it is closed. Unlimited if unset",
+				Required: false,
+				Hidden:   false,
+			},
+			&cli.StringFlag{
+				Name:     "audit-log",
+				Usage:    "File to append a JSON Lines audit entry to for every call and failed handshake, or - for stdout",
+				Required: false,
+				Hidden:   false,
+			},
+			&cli.IntFlag{
+				Name:     "audit-log-max-size",
+				Usage:    "Size in megabytes at which the audit log file is rotated",
+				Required: false,
+				Hidden:   false,
+				Value:    server.DefaultAuditMaxSizeMB,
+			},
+			&cli.IntFlag{
+				Name:     "audit-log-max-backups",
+				Usage:    "Number of rotated audit log files to keep, or 0 to keep them all",
+				Required: false,
+				Hidden:   false,
+			},
 		},
 		Action:                 Run,
 		UseShortOptionHandling: false,
 	}
-	app.Run(os.Args)
+
+	// Cancel on SIGTERM so that Kubernetes can shut us down gracefully
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	if err := app.RunContext(ctx, os.Args); err != nil {
+		log.Fatal(err)
+	}
 }
@@ -0,0 +1,109 @@
+package client
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/spiffetls/tlsconfig"
+
+	"github.com/jetstack/spiffe-demo/types"
+)
+
+// matcher returns an error describing why id doesn't match, completing the sentence
+// "the server presented <id>, ..."
+type matcher func(id spiffeid.ID) error
+
+// NewServerAuthorizer validates cfg and returns an authorizer accepting servers whose SPIFFE ID
+// matches every field set in cfg. When a server is rejected, the handshake fails with an error
+// naming the ID it presented and the condition it didn't meet.
+func NewServerAuthorizer(cfg types.ServerAuthorization) (tlsconfig.Authorizer, error) {
+	var matchers []matcher
+
+	if len(cfg.IDs) > 0 {
+		ids := make([]spiffeid.ID, 0, len(cfg.IDs))
+		for _, id := range cfg.IDs {
+			spiffeID, err := spiffeid.FromString(id)
+			if err != nil {
+				return nil, fmt.Errorf("invalid server SPIFFE ID %q: %w", id, err)
+			}
+			ids = append(ids, spiffeID)
+		}
+		matchers = append(matchers, func(id spiffeid.ID) error {
+			for _, expected := range ids {
+				if id == expected {
+					return nil
+				}
+			}
+			if len(ids) == 1 {
+				return fmt.Errorf("but %s was expected", ids[0])
+			}
+			return fmt.Errorf("which is not one of the expected IDs %s", strings.Join(cfg.IDs, ", "))
+		})
+	}
+
+	if len(cfg.TrustDomains) > 0 {
+		trustDomains := make([]spiffeid.TrustDomain, 0, len(cfg.TrustDomains))
+		for _, td := range cfg.TrustDomains {
+			trustDomain, err := spiffeid.TrustDomainFromString(td)
+			if err != nil {
+				return nil, fmt.Errorf("invalid server trust domain %q: %w", td, err)
+			}
+			trustDomains = append(trustDomains, trustDomain)
+		}
+		matchers = append(matchers, func(id spiffeid.ID) error {
+			for _, td := range trustDomains {
+				if id.MemberOf(td) {
+					return nil
+				}
+			}
+			return fmt.Errorf("which is not a member of the trust domain %s", strings.Join(cfg.TrustDomains, " or "))
+		})
+	}
+
+	if len(cfg.PathPrefixes) > 0 {
+		for _, prefix := range cfg.PathPrefixes {
+			if !strings.HasPrefix(prefix, "/") {
+				return nil, fmt.Errorf("server path prefix %q must start with /", prefix)
+			}
+		}
+		matchers = append(matchers, func(id spiffeid.ID) error {
+			for _, prefix := range cfg.PathPrefixes {
+				if strings.HasPrefix(id.Path(), prefix) {
+					return nil
+				}
+			}
+			return fmt.Errorf("whose path doesn't start with %s", strings.Join(cfg.PathPrefixes, " or "))
+		})
+	}
+
+	if len(cfg.Regex) > 0 {
+		// The expression must match the whole ID, so that an unanchored expression can't
+		// accidentally match a substring of some other ID.
+		regex, err := regexp.Compile(`^(?:` + cfg.Regex + `)$`)
+		if err != nil {
+			return nil, fmt.Errorf("invalid server ID regular expression %q: %w", cfg.Regex, err)
+		}
+		matchers = append(matchers, func(id spiffeid.ID) error {
+			if regex.MatchString(id.String()) {
+				return nil
+			}
+			return fmt.Errorf("which doesn't match the regular expression %s", cfg.Regex)
+		})
+	}
+
+	if len(matchers) == 0 {
+		return nil, errors.New("no server SPIFFE IDs, trust domains, path prefixes or regular expression to authorize the server with")
+	}
+	return func(id spiffeid.ID, _ [][]*x509.Certificate) error {
+		for _, m := range matchers {
+			if err := m(id); err != nil {
+				return fmt.Errorf("unexpected server: it presented %s, %w", id, err)
+			}
+		}
+		return nil
+	}, nil
+}
@@ -0,0 +1,111 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+
+	"github.com/jetstack/spiffe-demo/internal/pkg/testutil"
+	"github.com/jetstack/spiffe-demo/types"
+)
+
+func TestNewServerAuthorizerRejectsInvalidConfig(t *testing.T) {
+	tests := map[string]struct {
+		cfg     types.ServerAuthorization
+		wantErr string
+	}{
+		"nothing to authorize with": {
+			wantErr: "no server SPIFFE IDs, trust domains, path prefixes or regular expression",
+		},
+		"invalid SPIFFE ID": {
+			cfg:     types.ServerAuthorization{IDs: []string{"example.org/server"}},
+			wantErr: `invalid server SPIFFE ID "example.org/server"`,
+		},
+		"invalid trust domain": {
+			cfg:     types.ServerAuthorization{TrustDomains: []string{"spiffe://Example.org"}},
+			wantErr: `invalid server trust domain "spiffe://Example.org"`,
+		},
+		"path prefix without a slash": {
+			cfg:     types.ServerAuthorization{PathPrefixes: []string{"ns/"}},
+			wantErr: `server path prefix "ns/" must start with /`,
+		},
+		"invalid regular expression": {
+			cfg:     types.ServerAuthorization{Regex: "spiffe://example.org/(server"},
+			wantErr: `invalid server ID regular expression "spiffe://example.org/(server"`,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewServerAuthorizer(test.cfg)
+			testutil.AssertError(t, err, test.wantErr)
+		})
+	}
+}
+
+func TestServerAuthorizer(t *testing.T) {
+	tests := map[string]struct {
+		cfg     types.ServerAuthorization
+		id      string
+		wantErr string
+	}{
+		"expected ID": {
+			cfg: types.ServerAuthorization{IDs: []string{"spiffe://example.org/server"}},
+			id:  "spiffe://example.org/server",
+		},
+		"unexpected ID": {
+			cfg:     types.ServerAuthorization{IDs: []string{"spiffe://example.org/server"}},
+			id:      "spiffe://example.org/other",
+			wantErr: "unexpected server: it presented spiffe://example.org/other, but spiffe://example.org/server was expected",
+		},
+		"not one of the expected IDs": {
+			cfg:     types.ServerAuthorization{IDs: []string{"spiffe://example.org/a", "spiffe://example.org/b"}},
+			id:      "spiffe://example.org/other",
+			wantErr: "unexpected server: it presented spiffe://example.org/other, which is not one of the expected IDs spiffe://example.org/a, spiffe://example.org/b",
+		},
+		"member of a trust domain": {
+			cfg: types.ServerAuthorization{TrustDomains: []string{"example.org", "partner.example.com"}},
+			id:  "spiffe://partner.example.com/server",
+		},
+		"not a member of a trust domain": {
+			cfg:     types.ServerAuthorization{TrustDomains: []string{"example.org", "partner.example.com"}},
+			id:      "spiffe://other.example.com/server",
+			wantErr: "unexpected server: it presented spiffe://other.example.com/server, which is not a member of the trust domain example.org or partner.example.com",
+		},
+		"path prefix": {
+			cfg: types.ServerAuthorization{PathPrefixes: []string{"/ns/default/"}},
+			id:  "spiffe://example.org/ns/default/sa/server",
+		},
+		"wrong path prefix": {
+			cfg:     types.ServerAuthorization{PathPrefixes: []string{"/ns/default/"}},
+			id:      "spiffe://example.org/ns/other/sa/server",
+			wantErr: "unexpected server: it presented spiffe://example.org/ns/other/sa/server, whose path doesn't start with /ns/default/",
+		},
+		"regular expression": {
+			cfg: types.ServerAuthorization{Regex: `spiffe://example\.org/ns/[a-z]+/sa/server`},
+			id:  "spiffe://example.org/ns/default/sa/server",
+		},
+		"regular expression must match the whole ID": {
+			cfg:     types.ServerAuthorization{Regex: `spiffe://example\.org/ns/[a-z]+/sa/server`},
+			id:      "spiffe://example.org/ns/default/sa/server-2",
+			wantErr: "which doesn't match the regular expression",
+		},
+		"every field must match": {
+			cfg: types.ServerAuthorization{
+				TrustDomains: []string{"example.org"},
+				PathPrefixes: []string{"/ns/default/"},
+			},
+			id:      "spiffe://partner.example.com/ns/default/sa/server",
+			wantErr: "which is not a member of the trust domain example.org",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			authorizer, err := NewServerAuthorizer(test.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = authorizer(spiffeid.RequireFromString(test.id), nil)
+			testutil.AssertError(t, err, test.wantErr)
+		})
+	}
+}
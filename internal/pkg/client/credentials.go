@@ -0,0 +1,35 @@
+// Package client contains helpers for connecting to the SPIFFE demo server
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spiffe/go-spiffe/v2/svid/jwtsvid"
+	"google.golang.org/grpc/credentials"
+)
+
+// Interface guard
+var _ credentials.PerRPCCredentials = JWTSVIDCredentials{}
+
+// JWTSVIDCredentials attaches a JWT-SVID fetched from Source to every RPC as a bearer token.
+// A token is fetched for every RPC, so rotated tokens are picked up straight away.
+type JWTSVIDCredentials struct {
+	Source   jwtsvid.Source
+	Audience string
+}
+
+func (c JWTSVIDCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	svid, err := c.Source.FetchJWTSVID(ctx, jwtsvid.Params{Audience: c.Audience})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWT-SVID: %w", err)
+	}
+	return map[string]string{
+		"authorization": "Bearer " + svid.Marshal(),
+	}, nil
+}
+
+// RequireTransportSecurity is always true, a bearer token must never be sent in the clear.
+func (c JWTSVIDCredentials) RequireTransportSecurity() bool {
+	return true
+}
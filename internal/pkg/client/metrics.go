@@ -0,0 +1,67 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/spiffegrpc/grpccredentials"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/jetstack/spiffe-demo/internal/pkg/metrics"
+)
+
+// MetricsInterceptor records every unary RPC made by the client, labelled with the server's SPIFFE ID.
+func MetricsInterceptor(m *metrics.RPCMetrics) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		var p peer.Peer
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, append(opts, grpc.Peer(&p))...)
+		serverID, _ := grpccredentials.PeerIDFromPeer(&p)
+		m.Observe(method, status.Code(err), serverID, time.Since(start))
+		return err
+	}
+}
+
+// StreamMetricsInterceptor records every streaming RPC made by the client once it has finished.
+func StreamMetricsInterceptor(m *metrics.RPCMetrics) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		start := time.Now()
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			m.Observe(method, status.Code(err), spiffeid.ID{}, time.Since(start))
+			return nil, err
+		}
+		serverID, _ := grpccredentials.PeerIDFromContext(stream.Context())
+		return &observedStream{
+			ClientStream: stream,
+			finish: func(err error) {
+				m.Observe(method, status.Code(err), serverID, time.Since(start))
+			},
+		}, nil
+	}
+}
+
+// observedStream calls finish the first time receiving fails, which is when the stream has ended.
+type observedStream struct {
+	grpc.ClientStream
+	once   sync.Once
+	finish func(error)
+}
+
+func (s *observedStream) RecvMsg(msg interface{}) error {
+	err := s.ClientStream.RecvMsg(msg)
+	if err != nil {
+		result := err
+		if errors.Is(err, io.EOF) {
+			result = nil
+		}
+		s.once.Do(func() { s.finish(result) })
+	}
+	return err
+}
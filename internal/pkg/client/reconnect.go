@@ -0,0 +1,119 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
+	"google.golang.org/grpc"
+
+	"github.com/jetstack/spiffe-demo/internal/pkg/identity"
+)
+
+// Interface guard
+var _ grpc.ClientConnInterface = &ReconnectingConn{}
+
+// DefaultRotationCheckInterval is how often a ReconnectingConn checks whether our X509-SVID has changed.
+const DefaultRotationCheckInterval = 5 * time.Second
+
+// ReconnectingConn is a client connection that is re-dialled whenever our X509-SVID changes.
+// A connection keeps the certificate it was established with, so otherwise the server wouldn't
+// see a rotated SVID until the connection is closed for some other reason. Calls and streams
+// in progress on the previous connection are cancelled when it is replaced.
+type ReconnectingConn struct {
+	logger log.Logger
+	source x509svid.Source
+	dial   func() (*grpc.ClientConn, error)
+
+	mu   sync.RWMutex
+	conn *grpc.ClientConn
+	// leaf is the certificate of the SVID we had when conn was dialled
+	leaf []byte
+
+	stop    context.CancelFunc
+	stopped chan struct{}
+}
+
+// NewReconnectingConn dials a connection with dial, and dials it again whenever the X509-SVID in
+// source changes, checking every interval until ctx is done or the connection is closed.
+func NewReconnectingConn(ctx context.Context, logger log.Logger, source x509svid.Source, interval time.Duration, dial func() (*grpc.ClientConn, error)) (*ReconnectingConn, error) {
+	c := &ReconnectingConn{
+		logger:  logger,
+		source:  source,
+		dial:    dial,
+		stopped: make(chan struct{}),
+	}
+	if svid, err := source.GetX509SVID(); err == nil {
+		c.leaf = svid.Certificates[0].Raw
+	}
+	conn, err := dial()
+	if err != nil {
+		return nil, err
+	}
+	c.conn = conn
+
+	ctx, c.stop = context.WithCancel(ctx)
+	go c.watch(ctx, interval)
+	return c, nil
+}
+
+func (c *ReconnectingConn) watch(ctx context.Context, interval time.Duration) {
+	defer close(c.stopped)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+
+		svid, err := c.source.GetX509SVID()
+		if err != nil {
+			continue
+		}
+		c.mu.RLock()
+		changed := !bytes.Equal(svid.Certificates[0].Raw, c.leaf)
+		c.mu.RUnlock()
+		if !changed {
+			continue
+		}
+
+		level.Info(c.logger).Log("msg", "SVID changed, reconnecting", "spiffe_id", svid.ID, "serial", identity.SerialString(svid.Certificates[0]), "not_after", svid.Certificates[0].NotAfter)
+		conn, err := c.dial()
+		if err != nil {
+			level.Error(c.logger).Log("msg", "failed to reconnect", "error", err)
+			continue
+		}
+		c.mu.Lock()
+		previous := c.conn
+		c.conn, c.leaf = conn, svid.Certificates[0].Raw
+		c.mu.Unlock()
+		previous.Close()
+	}
+}
+
+func (c *ReconnectingConn) current() *grpc.ClientConn {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.conn
+}
+
+func (c *ReconnectingConn) Invoke(ctx context.Context, method string, args interface{}, reply interface{}, opts ...grpc.CallOption) error {
+	return c.current().Invoke(ctx, method, args, reply, opts...)
+}
+
+func (c *ReconnectingConn) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return c.current().NewStream(ctx, desc, method, opts...)
+}
+
+// Close stops watching for SVID changes and closes the current connection.
+func (c *ReconnectingConn) Close() error {
+	c.stop()
+	<-c.stopped
+	return c.current().Close()
+}
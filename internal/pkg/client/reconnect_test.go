@@ -0,0 +1,91 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/jetstack/spiffe-demo/internal/pkg/testutil"
+)
+
+// rotatingSource is an X509-SVID source whose SVID can be replaced.
+type rotatingSource struct {
+	mu   sync.Mutex
+	svid *x509svid.SVID
+}
+
+func (s *rotatingSource) GetX509SVID() (*x509svid.SVID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.svid, nil
+}
+
+func (s *rotatingSource) rotate(svid *x509svid.SVID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.svid = svid
+}
+
+func TestReconnectingConn(t *testing.T) {
+	ca := testutil.NewCA(t)
+	source := &rotatingSource{svid: ca.IssueSVID(t, "spiffe://example.org/client")}
+
+	var mu sync.Mutex
+	var dialled []*grpc.ClientConn
+	dial := func() (*grpc.ClientConn, error) {
+		// Dialling doesn't connect until the connection is used.
+		conn, err := grpc.Dial("passthrough:///unused", grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err == nil {
+			mu.Lock()
+			dialled = append(dialled, conn)
+			mu.Unlock()
+		}
+		return conn, err
+	}
+	connections := func() []*grpc.ClientConn {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]*grpc.ClientConn(nil), dialled...)
+	}
+
+	conn, err := NewReconnectingConn(context.Background(), log.NewNopLogger(), source, 10*time.Millisecond, dial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	first := connections()
+	if len(first) != 1 {
+		t.Fatalf("expected a single connection while the SVID is unchanged, got %d", len(first))
+	}
+
+	source.rotate(ca.IssueSVID(t, "spiffe://example.org/client"))
+	deadline := time.Now().Add(time.Second)
+	// The previous connection is closed once the new one has replaced it.
+	for first[0].GetState() != connectivity.Shutdown && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	conns := connections()
+	if len(conns) != 2 {
+		t.Fatalf("expected a new connection after the SVID rotated, got %d connections", len(conns))
+	}
+	if conn.current() != conns[1] {
+		t.Error("expected calls to use the new connection")
+	}
+	if state := conns[0].GetState(); state != connectivity.Shutdown {
+		t.Errorf("expected the previous connection to be closed, got %s", state)
+	}
+
+	if err := conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if state := conns[1].GetState(); state != connectivity.Shutdown {
+		t.Errorf("expected the connection to be closed, got %s", state)
+	}
+}
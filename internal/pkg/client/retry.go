@@ -0,0 +1,222 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/jetstack/spiffe-demo/internal/pkg/server/proto"
+	"github.com/jetstack/spiffe-demo/types"
+)
+
+const (
+	// DefaultRequestInterval is how long the client waits between successful calls, unless configured otherwise.
+	DefaultRequestInterval = time.Second
+	// DefaultRequestTimeout is how long a call may take including retries, unless configured otherwise.
+	DefaultRequestTimeout = time.Minute
+	// DefaultMaxAttempts is how many times a call is attempted, unless configured otherwise.
+	DefaultMaxAttempts = 3
+	// DefaultInitialBackoff is the backoff before the first retry, unless configured otherwise.
+	DefaultInitialBackoff = time.Second
+	// DefaultMaxBackoff caps the backoff, unless configured otherwise.
+	DefaultMaxBackoff = 30 * time.Second
+	// DefaultBackoffMultiplier is what the backoff is multiplied by after every failure, unless configured otherwise.
+	DefaultBackoffMultiplier = 2.0
+)
+
+// maxAttemptsLimit is the most attempts gRPC makes for a call, whatever the retry policy says.
+const maxAttemptsLimit = 5
+
+// backoffJitter is the fraction the backoff between calls is randomly increased or decreased by,
+// so that clients which failed at the same time don't all call again at the same time.
+const backoffJitter = 0.2
+
+// RetryPolicy is a validated types.RetryConfig, with defaults filled in.
+type RetryPolicy struct {
+	Interval               time.Duration
+	Timeout                time.Duration
+	MaxAttempts            int
+	InitialBackoff         time.Duration
+	MaxBackoff             time.Duration
+	BackoffMultiplier      float64
+	MaxConsecutiveFailures int
+}
+
+// NewRetryPolicy validates cfg, which may be nil, and returns the policy it describes.
+func NewRetryPolicy(cfg *types.RetryConfig) (*RetryPolicy, error) {
+	if cfg == nil {
+		cfg = &types.RetryConfig{}
+	}
+	p := &RetryPolicy{
+		Interval:               DefaultRequestInterval,
+		Timeout:                DefaultRequestTimeout,
+		MaxAttempts:            DefaultMaxAttempts,
+		InitialBackoff:         DefaultInitialBackoff,
+		MaxBackoff:             DefaultMaxBackoff,
+		BackoffMultiplier:      DefaultBackoffMultiplier,
+		MaxConsecutiveFailures: cfg.MaxConsecutiveFailures,
+	}
+	if cfg.Interval < 0 || cfg.Timeout < 0 || cfg.InitialBackoff < 0 || cfg.MaxBackoff < 0 {
+		return nil, errors.New("durations must not be negative")
+	}
+	if cfg.Interval > 0 {
+		p.Interval = cfg.Interval
+	}
+	if cfg.Timeout > 0 {
+		p.Timeout = cfg.Timeout
+	}
+	if cfg.InitialBackoff > 0 {
+		p.InitialBackoff = cfg.InitialBackoff
+	}
+	if cfg.MaxBackoff > 0 {
+		p.MaxBackoff = cfg.MaxBackoff
+	}
+	if cfg.MaxAttempts < 0 || cfg.MaxAttempts > maxAttemptsLimit {
+		return nil, fmt.Errorf("max attempts must be between 1 and %d", maxAttemptsLimit)
+	}
+	if cfg.MaxAttempts > 0 {
+		p.MaxAttempts = cfg.MaxAttempts
+	}
+	if cfg.BackoffMultiplier != 0 && cfg.BackoffMultiplier < 1 {
+		return nil, errors.New("backoff multiplier must be at least 1")
+	}
+	if cfg.BackoffMultiplier > 0 {
+		p.BackoffMultiplier = cfg.BackoffMultiplier
+	}
+	if p.MaxBackoff < p.InitialBackoff {
+		return nil, fmt.Errorf("max backoff %s is shorter than initial backoff %s", p.MaxBackoff, p.InitialBackoff)
+	}
+	if cfg.MaxConsecutiveFailures < 0 {
+		return nil, errors.New("max consecutive failures must not be negative")
+	}
+	return p, nil
+}
+
+// ServiceConfig returns a gRPC service config retrying every SpiffeDemo method that fails with
+// Unavailable, for use with grpc.WithDefaultServiceConfig. gRPC only retries calls that haven't
+// received a response yet, and adds its own jitter to the backoff between attempts.
+func (p *RetryPolicy) ServiceConfig() string {
+	type retryPolicy struct {
+		MaxAttempts          int      `json:"maxAttempts"`
+		InitialBackoff       string   `json:"initialBackoff"`
+		MaxBackoff           string   `json:"maxBackoff"`
+		BackoffMultiplier    float64  `json:"backoffMultiplier"`
+		RetryableStatusCodes []string `json:"retryableStatusCodes"`
+	}
+	type methodConfig struct {
+		Name        []map[string]string `json:"name"`
+		RetryPolicy *retryPolicy        `json:"retryPolicy,omitempty"`
+	}
+	method := methodConfig{
+		Name: []map[string]string{{"service": proto.SpiffeDemo_ServiceDesc.ServiceName}},
+	}
+	// gRPC rejects retry policies with fewer than 2 attempts
+	if p.MaxAttempts > 1 {
+		method.RetryPolicy = &retryPolicy{
+			MaxAttempts:          p.MaxAttempts,
+			InitialBackoff:       serviceConfigDuration(p.InitialBackoff),
+			MaxBackoff:           serviceConfigDuration(p.MaxBackoff),
+			BackoffMultiplier:    p.BackoffMultiplier,
+			RetryableStatusCodes: []string{"UNAVAILABLE"},
+		}
+	}
+	serviceConfig, _ := json.Marshal(map[string][]methodConfig{"methodConfig": {method}})
+	return string(serviceConfig)
+}
+
+// serviceConfigDuration formats d as a number of seconds, such as 1.5s, as gRPC expects.
+func serviceConfigDuration(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "s"
+}
+
+// Backoff returns how long to wait before the next call after the given number of consecutive
+// failed calls. It grows exponentially from InitialBackoff up to MaxBackoff, with some jitter,
+// but is never shorter than Interval.
+func (p *RetryPolicy) Backoff(failures int) time.Duration {
+	backoff := float64(p.InitialBackoff) * math.Pow(p.BackoffMultiplier, float64(failures-1))
+	if backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+	backoff *= 1 + backoffJitter*(2*rand.Float64()-1)
+	if d := time.Duration(backoff); d > p.Interval {
+		return d
+	}
+	return p.Interval
+}
+
+// FailureReason describes why a call failed.
+type FailureReason string
+
+const (
+	// FailureServerIdentity means the server's SVID was rejected by our server authorization,
+	// deny list or CRLs.
+	FailureServerIdentity FailureReason = "server_identity"
+	// FailurePermissionDenied means the server rejected the call, for example due to its policy.
+	FailurePermissionDenied FailureReason = "permission_denied"
+	// FailureTLS means the TLS handshake failed for another reason, such as a certificate signed by
+	// a CA that isn't trusted yet, which is often transient while SVIDs or trust bundles are rotated.
+	FailureTLS FailureReason = "tls_handshake"
+	// FailureUnavailable means the server couldn't be reached.
+	FailureUnavailable FailureReason = "unavailable"
+	// FailureRateLimited means the call exceeded one of the server's rate limits.
+	FailureRateLimited FailureReason = "rate_limited"
+	// FailureTimeout means the call didn't finish within its timeout.
+	FailureTimeout FailureReason = "timeout"
+	// FailureOther is any other error.
+	FailureOther FailureReason = "error"
+)
+
+// Transient reports whether calls failing for this reason may succeed if they are retried later,
+// rather than needing the configuration of the client, the server or their SVIDs to be changed.
+func (r FailureReason) Transient() bool {
+	switch r {
+	case FailureTLS, FailureUnavailable, FailureRateLimited, FailureTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// handshakeRejections are parts of the errors returned by our server authorizer, the deny list and
+// CRLs. gRPC only passes on the text of handshake errors, so they can't be matched with errors.Is.
+var handshakeRejections = []string{
+	"unexpected server: ",
+	" is on the deny list ",
+	" has been revoked by ",
+}
+
+// ClassifyFailure returns the reason a call failed with err.
+func ClassifyFailure(err error) FailureReason {
+	s, ok := status.FromError(err)
+	if !ok {
+		return FailureOther
+	}
+	switch s.Code() {
+	case codes.PermissionDenied, codes.Unauthenticated:
+		return FailurePermissionDenied
+	case codes.ResourceExhausted:
+		return FailureRateLimited
+	case codes.DeadlineExceeded:
+		return FailureTimeout
+	case codes.Unavailable:
+		if !strings.Contains(s.Message(), "authentication handshake failed") {
+			return FailureUnavailable
+		}
+		for _, rejection := range handshakeRejections {
+			if strings.Contains(s.Message(), rejection) {
+				return FailureServerIdentity
+			}
+		}
+		return FailureTLS
+	default:
+		return FailureOther
+	}
+}
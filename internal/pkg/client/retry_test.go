@@ -0,0 +1,260 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/jetstack/spiffe-demo/internal/pkg/testutil"
+	"github.com/jetstack/spiffe-demo/types"
+)
+
+func TestNewRetryPolicy(t *testing.T) {
+	defaults := RetryPolicy{
+		Interval:          DefaultRequestInterval,
+		Timeout:           DefaultRequestTimeout,
+		MaxAttempts:       DefaultMaxAttempts,
+		InitialBackoff:    DefaultInitialBackoff,
+		MaxBackoff:        DefaultMaxBackoff,
+		BackoffMultiplier: DefaultBackoffMultiplier,
+	}
+	tests := map[string]struct {
+		cfg     *types.RetryConfig
+		want    RetryPolicy
+		wantErr string
+	}{
+		"no config": {
+			want: defaults,
+		},
+		"empty config": {
+			cfg:  &types.RetryConfig{},
+			want: defaults,
+		},
+		"everything set": {
+			cfg: &types.RetryConfig{
+				Interval:               5 * time.Second,
+				Timeout:                10 * time.Second,
+				MaxAttempts:            1,
+				InitialBackoff:         500 * time.Millisecond,
+				MaxBackoff:             time.Minute,
+				BackoffMultiplier:      1.5,
+				MaxConsecutiveFailures: 3,
+			},
+			want: RetryPolicy{
+				Interval:               5 * time.Second,
+				Timeout:                10 * time.Second,
+				MaxAttempts:            1,
+				InitialBackoff:         500 * time.Millisecond,
+				MaxBackoff:             time.Minute,
+				BackoffMultiplier:      1.5,
+				MaxConsecutiveFailures: 3,
+			},
+		},
+		"negative duration": {
+			cfg:     &types.RetryConfig{Timeout: -time.Second},
+			wantErr: "durations must not be negative",
+		},
+		"too many attempts": {
+			cfg:     &types.RetryConfig{MaxAttempts: 6},
+			wantErr: "max attempts must be between 1 and 5",
+		},
+		"multiplier below 1": {
+			cfg:     &types.RetryConfig{BackoffMultiplier: 0.5},
+			wantErr: "backoff multiplier must be at least 1",
+		},
+		"max backoff shorter than the default initial backoff": {
+			cfg:     &types.RetryConfig{MaxBackoff: 500 * time.Millisecond},
+			wantErr: "max backoff 500ms is shorter than initial backoff 1s",
+		},
+		"negative max consecutive failures": {
+			cfg:     &types.RetryConfig{MaxConsecutiveFailures: -1},
+			wantErr: "max consecutive failures must not be negative",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := NewRetryPolicy(test.cfg)
+			testutil.AssertError(t, err, test.wantErr)
+			if err != nil {
+				return
+			}
+			if *got != test.want {
+				t.Errorf("expected %+v, got %+v", test.want, *got)
+			}
+		})
+	}
+}
+
+func TestServiceConfig(t *testing.T) {
+	tests := map[string]struct {
+		maxAttempts     int
+		wantRetryPolicy bool
+	}{
+		"retries":    {maxAttempts: 3, wantRetryPolicy: true},
+		"no retries": {maxAttempts: 1},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			p, err := NewRetryPolicy(&types.RetryConfig{MaxAttempts: test.maxAttempts, InitialBackoff: 1500 * time.Millisecond})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var serviceConfig struct {
+				MethodConfig []struct {
+					Name        []map[string]string `json:"name"`
+					RetryPolicy *struct {
+						MaxAttempts          int      `json:"maxAttempts"`
+						InitialBackoff       string   `json:"initialBackoff"`
+						MaxBackoff           string   `json:"maxBackoff"`
+						RetryableStatusCodes []string `json:"retryableStatusCodes"`
+					} `json:"retryPolicy"`
+				} `json:"methodConfig"`
+			}
+			if err := json.Unmarshal([]byte(p.ServiceConfig()), &serviceConfig); err != nil {
+				t.Fatal(err)
+			}
+			if len(serviceConfig.MethodConfig) != 1 || serviceConfig.MethodConfig[0].Name[0]["service"] != "SpiffeDemo" {
+				t.Fatalf("expected a single method config for the SpiffeDemo service, got %s", p.ServiceConfig())
+			}
+			retryPolicy := serviceConfig.MethodConfig[0].RetryPolicy
+			if !test.wantRetryPolicy {
+				if retryPolicy != nil {
+					t.Errorf("expected no retry policy, got %s", p.ServiceConfig())
+				}
+				return
+			}
+			if retryPolicy == nil ||
+				retryPolicy.MaxAttempts != test.maxAttempts ||
+				retryPolicy.InitialBackoff != "1.5s" ||
+				retryPolicy.MaxBackoff != "30s" ||
+				strings.Join(retryPolicy.RetryableStatusCodes, ",") != "UNAVAILABLE" {
+				t.Errorf("unexpected retry policy %s", p.ServiceConfig())
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p, err := NewRetryPolicy(&types.RetryConfig{
+		Interval:       2 * time.Second,
+		InitialBackoff: time.Second,
+		MaxBackoff:     10 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]struct {
+		failures int
+		min, max time.Duration
+	}{
+		"never shorter than the interval": {failures: 1, min: 2 * time.Second, max: 2 * time.Second},
+		"grows exponentially":             {failures: 3, min: 3200 * time.Millisecond, max: 4800 * time.Millisecond},
+		"capped at max backoff":           {failures: 10, min: 8 * time.Second, max: 12 * time.Second},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				if got := p.Backoff(test.failures); got < test.min || got > test.max {
+					t.Fatalf("expected a backoff between %s and %s, got %s", test.min, test.max, got)
+				}
+			}
+		})
+	}
+}
+
+func TestClassifyFailure(t *testing.T) {
+	authorizer, err := NewServerAuthorizer(types.ServerAuthorization{IDs: []string{"spiffe://example.org/server"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorizationErr := authorizer(spiffeid.RequireFromString("spiffe://example.org/other"), nil)
+
+	// handshakeFailure returns err as gRPC reports a failed handshake.
+	handshakeFailure := func(err error) error {
+		return status.Error(codes.Unavailable, fmt.Sprintf("connection error: desc = \"transport: authentication handshake failed: %s\"", err))
+	}
+	tests := map[string]struct {
+		err  error
+		want FailureReason
+	}{
+		"server rejected by our authorizer": {
+			err:  handshakeFailure(authorizationErr),
+			want: FailureServerIdentity,
+		},
+		// The deny list and CRL tests in the config package pin the wording of these errors.
+		"server on the deny list": {
+			err:  handshakeFailure(errors.New("spiffe://example.org/server is on the deny list (/ns/compromised/)")),
+			want: FailureServerIdentity,
+		},
+		"server certificate revoked": {
+			err:  handshakeFailure(errors.New("leaf certificate with serial a has been revoked by /etc/crls/ca.crl")),
+			want: FailureServerIdentity,
+		},
+		"untrusted CA": {
+			err:  handshakeFailure(errors.New("x509svid: could not verify leaf certificate: x509: certificate signed by unknown authority")),
+			want: FailureTLS,
+		},
+		"server unreachable": {
+			err:  status.Error(codes.Unavailable, "connection error: desc = \"transport: Error while dialing dial tcp [::1]:9090: connect: connection refused\""),
+			want: FailureUnavailable,
+		},
+		"permission denied": {
+			err:  status.Error(codes.PermissionDenied, "spiffe://example.org/client is not allowed to call /SpiffeDemo/HelloWorld"),
+			want: FailurePermissionDenied,
+		},
+		"unauthenticated": {
+			err:  status.Error(codes.Unauthenticated, "invalid JWT-SVID"),
+			want: FailurePermissionDenied,
+		},
+		"rate limited": {
+			err:  status.Error(codes.ResourceExhausted, "rate limit exceeded"),
+			want: FailureRateLimited,
+		},
+		"timeout": {
+			err:  status.FromContextError(context.DeadlineExceeded).Err(),
+			want: FailureTimeout,
+		},
+		"other status": {
+			err:  status.Error(codes.Internal, "something went wrong"),
+			want: FailureOther,
+		},
+		"not a status": {
+			err:  errors.New("something went wrong"),
+			want: FailureOther,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := ClassifyFailure(test.err); got != test.want {
+				t.Errorf("expected %s, got %s", test.want, got)
+			}
+		})
+	}
+}
+
+func TestFailureReasonTransient(t *testing.T) {
+	tests := map[FailureReason]bool{
+		FailureServerIdentity:   false,
+		FailurePermissionDenied: false,
+		FailureTLS:              true,
+		FailureUnavailable:      true,
+		FailureRateLimited:      true,
+		FailureTimeout:          true,
+		FailureOther:            false,
+	}
+	for reason, want := range tests {
+		t.Run(string(reason), func(t *testing.T) {
+			if got := reason.Transient(); got != want {
+				t.Errorf("expected %t, got %t", want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package client
+
+import (
+	"context"
+
+	"github.com/spiffe/go-spiffe/v2/spiffegrpc/grpccredentials"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+
+	"github.com/jetstack/spiffe-demo/internal/pkg/tracing"
+)
+
+// TracingInterceptors start a span for every unary RPC, propagating it to the server in the
+// call's metadata, and add the SPIFFE IDs of the client and server to it.
+func TracingInterceptors() []grpc.UnaryClientInterceptor {
+	return []grpc.UnaryClientInterceptor{otelgrpc.UnaryClientInterceptor(), annotateUnary}
+}
+
+// StreamTracingInterceptors start a span for every streaming RPC, propagating it to the server
+// in the call's metadata, and add the SPIFFE IDs of the client and server to it.
+func StreamTracingInterceptors() []grpc.StreamClientInterceptor {
+	return []grpc.StreamClientInterceptor{otelgrpc.StreamClientInterceptor(), annotateStream}
+}
+
+// annotateUnary runs inside the span started by otelgrpc, so that it can add the server's
+// identity once the call has been made.
+func annotateUnary(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	var p peer.Peer
+	err := invoker(ctx, method, req, reply, cc, append(opts, grpc.Peer(&p))...)
+	serverID, _ := grpccredentials.PeerIDFromPeer(&p)
+	tracing.Annotate(trace.SpanFromContext(ctx), serverID, &p)
+	return err
+}
+
+// annotateStream runs inside the span started by otelgrpc, so that it can add the server's
+// identity once the stream has been opened.
+func annotateStream(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	stream, err := streamer(ctx, desc, cc, method, opts...)
+	if err != nil {
+		tracing.Annotate(trace.SpanFromContext(ctx), spiffeid.ID{}, nil)
+		return nil, err
+	}
+	p, _ := peer.FromContext(stream.Context())
+	serverID, _ := grpccredentials.PeerIDFromContext(stream.Context())
+	tracing.Annotate(trace.SpanFromContext(ctx), serverID, p)
+	return stream, nil
+}
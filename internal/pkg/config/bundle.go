@@ -0,0 +1,57 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/spiffe/go-spiffe/v2/bundle/jwtbundle"
+	"github.com/spiffe/go-spiffe/v2/bundle/spiffebundle"
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+)
+
+// loadTrustBundle reads a trust bundle file in either PEM or SPIFFE bundle (JWKS) format.
+// Only the SPIFFE bundle format carries JWT authorities, so the returned JWT bundle is nil
+// for PEM files.
+func loadTrustBundle(trustDomain spiffeid.TrustDomain, path string) (*x509bundle.Bundle, *jwtbundle.Bundle, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read trust bundle file: %w", err)
+	}
+
+	if !isSPIFFEBundle(raw) {
+		bundle, err := x509bundle.Parse(trustDomain, raw)
+		if err != nil {
+			return nil, nil, err
+		}
+		return bundle, nil, nil
+	}
+
+	bundle, err := spiffebundle.Parse(trustDomain, raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	return bundle.X509Bundle(), bundle.JWTBundle(), nil
+}
+
+// isSPIFFEBundle reports whether raw looks like a SPIFFE bundle, which is a JSON document,
+// rather than a list of PEM encoded certificates.
+func isSPIFFEBundle(raw []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(raw), []byte("{"))
+}
+
+// loadJWTBundle reads a JWKS file containing JWT authorities. SPIFFE bundles are accepted too,
+// in which case only their JWT authorities are used.
+func loadJWTBundle(trustDomain spiffeid.TrustDomain, path string) (*jwtbundle.Bundle, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read JWT bundle file: %w", err)
+	}
+
+	// SPIFFE bundles mark JWT authorities with "use": "jwt-svid", plain JWKS documents don't.
+	if bundle, err := spiffebundle.Parse(trustDomain, raw); err == nil && !bundle.JWTBundle().Empty() {
+		return bundle.JWTBundle(), nil
+	}
+	return jwtbundle.Parse(trustDomain, raw)
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/spiffe/go-spiffe/v2/bundle/spiffebundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+
+	"github.com/jetstack/spiffe-demo/internal/pkg/testutil"
+)
+
+func TestLoadTrustBundle(t *testing.T) {
+	dir := t.TempDir()
+	trustDomain := spiffeid.RequireTrustDomainFromString("example.org")
+	ca := testutil.NewCA(t)
+
+	spiffeBundle := spiffebundle.New(trustDomain)
+	spiffeBundle.AddX509Authority(ca.Cert)
+	if err := spiffeBundle.AddJWTAuthority("key-1", ca.Key.Public()); err != nil {
+		t.Fatal(err)
+	}
+	jwks, err := spiffeBundle.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		contents []byte
+		wantJWT  bool
+		wantErr  string
+	}{
+		"PEM": {
+			contents: ca.CertPEM(),
+		},
+		"SPIFFE bundle": {
+			contents: jwks,
+			wantJWT:  true,
+		},
+		"SPIFFE bundle with leading whitespace": {
+			contents: append([]byte("\n  "), jwks...),
+			wantJWT:  true,
+		},
+		"invalid SPIFFE bundle": {
+			contents: []byte(`{"keys": [`),
+			wantErr:  "unable to parse JWKS",
+		},
+		"invalid PEM": {
+			contents: []byte("not a bundle"),
+			wantErr:  "no PEM blocks found",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := testutil.WriteFile(t, dir, "bundle", test.contents)
+			bundle, jwtBundle, err := loadTrustBundle(trustDomain, path)
+			testutil.AssertError(t, err, test.wantErr)
+			if err != nil {
+				return
+			}
+			if authorities := bundle.X509Authorities(); len(authorities) != 1 || !authorities[0].Equal(ca.Cert) {
+				t.Error("expected the bundle to contain the CA")
+			}
+			if test.wantJWT != (jwtBundle != nil) {
+				t.Fatalf("expected JWT bundle: %t, got %v", test.wantJWT, jwtBundle)
+			}
+			if test.wantJWT && !jwtBundle.HasJWTAuthority("key-1") {
+				t.Error("expected the JWT bundle to contain key-1")
+			}
+		})
+	}
+
+	if _, _, err := loadTrustBundle(trustDomain, dir+"/missing"); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
@@ -1,10 +1,17 @@
 package config
 
 import (
+	"context"
 	"fmt"
 	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"sync/atomic"
 
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
 	"gopkg.in/yaml.v2"
 
 	"github.com/jetstack/spiffe-demo/types"
@@ -15,6 +22,12 @@ var (
 	currentSource atomic.Value // *SpiffeDemoSource
 
 	CurrentSource DynamicSource
+
+	reloadHooksMu sync.Mutex
+	reloadHooks   []ReloadHook
+
+	bundleChangeHooksMu sync.Mutex
+	bundleChangeHooks   []func()
 )
 
 func init() {
@@ -35,9 +48,33 @@ func ReadConfigFromFS(fsys fs.FS, path string) (*types.ConfigFile, error) {
 		return nil, fmt.Errorf("failed to unmarshal config: %s", err)
 	}
 
+	if cfg.Server != nil {
+		if cfg.Server.Authentication.Mode, err = NormaliseAuthMode(cfg.Server.Authentication.Mode); err != nil {
+			return nil, fmt.Errorf("invalid server.authentication.mode: %w", err)
+		}
+	}
+	if cfg.Client != nil {
+		if cfg.Client.Authentication.Mode, err = NormaliseAuthMode(cfg.Client.Authentication.Mode); err != nil {
+			return nil, fmt.Errorf("invalid client.authentication.mode: %w", err)
+		}
+	}
+
 	return &cfg, nil
 }
 
+// NormaliseAuthMode returns mode as one of types.AuthModeMTLS or types.AuthModeJWT, ignoring case
+// and surrounding spaces and defaulting to types.AuthModeMTLS, or an error if it is neither.
+func NormaliseAuthMode(mode string) (string, error) {
+	switch normalised := strings.ToLower(strings.TrimSpace(mode)); normalised {
+	case "":
+		return types.AuthModeMTLS, nil
+	case types.AuthModeMTLS, types.AuthModeJWT:
+		return normalised, nil
+	default:
+		return "", fmt.Errorf("unknown authentication mode %q, must be %s or %s", mode, types.AuthModeMTLS, types.AuthModeJWT)
+	}
+}
+
 func ReadAndStoreConfig(fsys fs.FS, path string) error {
 	config, err := ReadConfigFromFS(fsys, path)
 	if err != nil {
@@ -55,6 +92,52 @@ func GetCurrentConfig() *types.ConfigFile {
 	return currentConfig.Load().(*types.ConfigFile)
 }
 
+// ReloadHook validates a config file loaded by ReloadFromFile and prepares anything derived from
+// it, before it becomes the current config. If it returns an error the config is rejected. The
+// returned commit function applies what was prepared, and is only called once every hook has
+// accepted the config, so that a rejected config has no effect at all.
+type ReloadHook func(cfg *types.ConfigFile) (commit func(), err error)
+
+// AddReloadHook registers a hook to be called with every config file loaded by ReloadFromFile.
+func AddReloadHook(hook ReloadHook) {
+	reloadHooksMu.Lock()
+	defer reloadHooksMu.Unlock()
+	reloadHooks = append(reloadHooks, hook)
+}
+
+// runReloadHooks calls every reload hook with cfg, and returns their commit functions if all of
+// them accepted it.
+func runReloadHooks(cfg *types.ConfigFile) ([]func(), error) {
+	reloadHooksMu.Lock()
+	defer reloadHooksMu.Unlock()
+	commits := make([]func(), 0, len(reloadHooks))
+	for _, hook := range reloadHooks {
+		commit, err := hook(cfg)
+		if err != nil {
+			return nil, err
+		}
+		commits = append(commits, commit)
+	}
+	return commits, nil
+}
+
+// AddBundleChangeHook registers a function to be called whenever a trust bundle, CRL or deny list
+// file is reloaded or a new source is loaded from the config file, for example to re-check connections authenticated
+// with the previous bundle. Changes to bundles received from the workload API are not reported.
+func AddBundleChangeHook(hook func()) {
+	bundleChangeHooksMu.Lock()
+	defer bundleChangeHooksMu.Unlock()
+	bundleChangeHooks = append(bundleChangeHooks, hook)
+}
+
+func runBundleChangeHooks() {
+	bundleChangeHooksMu.Lock()
+	defer bundleChangeHooksMu.Unlock()
+	for _, hook := range bundleChangeHooks {
+		hook()
+	}
+}
+
 func StoreCurrentSource(source *SpiffeDemoSource) {
 	currentSource.Store(source)
 }
@@ -62,3 +145,50 @@ func StoreCurrentSource(source *SpiffeDemoSource) {
 func GetCurrentSource() *SpiffeDemoSource {
 	return currentSource.Load().(*SpiffeDemoSource)
 }
+
+// ReloadFromFile reads the config file at path and constructs a new SpiffeDemoSource from it.
+// The config and source are only stored, and the reload hooks' changes committed, if the source
+// could be constructed and all reload hooks accepted the config, in which case the previous source
+// is cancelled after the new one has been swapped in. The new source logs to logger.
+func ReloadFromFile(ctx context.Context, logger log.Logger, path string) error {
+	cfg, err := ReadConfigFromFS(os.DirFS(filepath.Dir(path)), filepath.Base(path))
+	if err != nil {
+		return err
+	}
+
+	sourceCtx, sourceCancel := context.WithCancel(ctx)
+	source, err := ConstructSpiffeDemoSource(sourceCtx, sourceCancel, logger, cfg.SPIFFE)
+	if err != nil {
+		sourceCancel()
+		return fmt.Errorf("failed to construct source from config file: %w", err)
+	}
+	commits, err := runReloadHooks(cfg)
+	if err != nil {
+		source.Cancel()
+		return fmt.Errorf("invalid config file: %w", err)
+	}
+
+	StoreConfig(cfg)
+	previous := currentSource.Swap(source).(*SpiffeDemoSource)
+	previous.Cancel()
+	for _, commit := range commits {
+		commit()
+	}
+	runBundleChangeHooks()
+	return nil
+}
+
+// WatchConfigFile loads the config file at path and then reloads it whenever it changes,
+// so that the current source always reflects the file on disk.
+func WatchConfigFile(ctx context.Context, logger log.Logger, path string) (*Watcher, error) {
+	if err := ReloadFromFile(ctx, logger, path); err != nil {
+		return nil, err
+	}
+	return NewWatcher(ctx, logger, path, func() error {
+		if err := ReloadFromFile(ctx, logger, path); err != nil {
+			return err
+		}
+		level.Info(logger).Log("msg", "reloaded config file", "file", path)
+		return nil
+	})
+}
@@ -0,0 +1,216 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/go-kit/log"
+
+	"github.com/jetstack/spiffe-demo/internal/pkg/testutil"
+	"github.com/jetstack/spiffe-demo/types"
+)
+
+// watchContext returns a context for the sources created by a test, and a directory for the files
+// they watch. A Watcher exits the process if its file is removed, so the context is cancelled and
+// the watchers are given a moment to stop before the directory is removed.
+func watchContext(t *testing.T) (context.Context, string) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		cancel()
+		time.Sleep(100 * time.Millisecond)
+	})
+	return ctx, dir
+}
+
+// writeConfig writes a config file reading a new SVID for id and its CA's bundle from files in a
+// new directory in dir, and returns its path.
+func writeConfig(t *testing.T, dir, id string) string {
+	t.Helper()
+	dir, err := os.MkdirTemp(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca := testutil.NewCA(t)
+	cert, key := testutil.WriteSVID(t, dir, ca.IssueSVID(t, id))
+	bundle := testutil.WriteFile(t, dir, "ca.pem", ca.CertPEM())
+	return testutil.WriteFile(t, dir, "config.yaml", []byte(fmt.Sprintf(`
+spiffe:
+  svid_sources:
+    files:
+      trust_domain_ca: %s
+      svid_cert: %s
+      svid_key: %s
+`, bundle, cert, key)))
+}
+
+// resetCurrent restores the current config and source once the test has finished.
+func resetCurrent(t *testing.T) {
+	t.Cleanup(func() {
+		StoreConfig(new(types.ConfigFile))
+		StoreCurrentSource(new(SpiffeDemoSource))
+	})
+}
+
+func TestReloadFromFile(t *testing.T) {
+	ctx, dir := watchContext(t)
+	resetCurrent(t)
+	if err := ReloadFromFile(ctx, log.NewNopLogger(), writeConfig(t, dir, "spiffe://example.org/first")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		config  string
+		wantID  string
+		wantErr string
+	}{
+		"missing file": {
+			config:  dir + "/missing.yaml",
+			wantErr: "failed to read config file",
+		},
+		"invalid YAML": {
+			config:  testutil.WriteFile(t, dir, "invalid.yaml", []byte("spiffe: [")),
+			wantErr: "failed to unmarshal config",
+		},
+		"no SVID sources": {
+			config:  testutil.WriteFile(t, dir, "empty.yaml", []byte("spiffe: {}")),
+			wantErr: "failed to construct source from config file: neither workload API nor files provided",
+		},
+		"new SVID": {
+			config: writeConfig(t, dir, "spiffe://example.org/second"),
+			wantID: "spiffe://example.org/second",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			previousConfig, previousSource := GetCurrentConfig(), GetCurrentSource()
+			err := ReloadFromFile(ctx, log.NewNopLogger(), test.config)
+			testutil.AssertError(t, err, test.wantErr)
+			if err != nil {
+				if GetCurrentConfig() != previousConfig || GetCurrentSource() != previousSource {
+					t.Error("expected the current config and source to be kept")
+				}
+				return
+			}
+			svid, err := CurrentSource.GetX509SVID()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if svid.ID.String() != test.wantID {
+				t.Errorf("expected the current SVID to be %s, got %s", test.wantID, svid.ID)
+			}
+		})
+	}
+}
+
+func TestReloadHooks(t *testing.T) {
+	ctx, dir := watchContext(t)
+	resetCurrent(t)
+	t.Cleanup(func() { reloadHooks = nil })
+
+	var committed []string
+	hook := func(name string, err error) ReloadHook {
+		return func(cfg *types.ConfigFile) (func(), error) {
+			if GetCurrentConfig() == cfg {
+				t.Errorf("expected hook %s to run before the config is stored", name)
+			}
+			return func() {
+				if GetCurrentConfig() != cfg {
+					t.Errorf("expected hook %s to commit after the config is stored", name)
+				}
+				committed = append(committed, name)
+			}, err
+		}
+	}
+
+	tests := map[string]struct {
+		hooks         []ReloadHook
+		wantCommitted []string
+		wantErr       string
+	}{
+		"all hooks accept": {
+			hooks:         []ReloadHook{hook("first", nil), hook("second", nil)},
+			wantCommitted: []string{"first", "second"},
+		},
+		"a hook rejects": {
+			hooks:   []ReloadHook{hook("first", nil), hook("second", errors.New("rejected"))},
+			wantErr: "invalid config file: rejected",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			reloadHooks, committed = nil, nil
+			for _, hook := range test.hooks {
+				AddReloadHook(hook)
+			}
+			previousConfig := GetCurrentConfig()
+			err := ReloadFromFile(ctx, log.NewNopLogger(), writeConfig(t, dir, "spiffe://example.org/client"))
+			testutil.AssertError(t, err, test.wantErr)
+			if err != nil && GetCurrentConfig() != previousConfig {
+				t.Error("expected the current config to be kept")
+			}
+			if fmt.Sprint(committed) != fmt.Sprint(test.wantCommitted) {
+				t.Errorf("expected commits %v, got %v", test.wantCommitted, committed)
+			}
+		})
+	}
+}
+
+func TestNormaliseAuthMode(t *testing.T) {
+	tests := map[string]struct {
+		mode    string
+		want    string
+		wantErr string
+	}{
+		"empty":           {mode: "", want: types.AuthModeMTLS},
+		"mTLS":            {mode: "mtls", want: types.AuthModeMTLS},
+		"JWT":             {mode: "jwt", want: types.AuthModeJWT},
+		"case and spaces": {mode: " JWT ", want: types.AuthModeJWT},
+		"unknown":         {mode: "basic", wantErr: `unknown authentication mode "basic", must be mtls or jwt`},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := NormaliseAuthMode(test.mode)
+			testutil.AssertError(t, err, test.wantErr)
+			if got != test.want {
+				t.Errorf("expected %q, got %q", test.want, got)
+			}
+		})
+	}
+}
+
+func TestReadConfigFromFSNormalisesAuthModes(t *testing.T) {
+	fsys := fstest.MapFS{
+		"valid.yaml":   {Data: []byte("server:\n  authentication:\n    mode: JWT\nclient: {}\n")},
+		"invalid.yaml": {Data: []byte("client:\n  authentication:\n    mode: basic\n")},
+	}
+	cfg, err := ReadConfigFromFS(fsys, "valid.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Authentication.Mode != types.AuthModeJWT || cfg.Client.Authentication.Mode != types.AuthModeMTLS {
+		t.Errorf("expected modes jwt and mtls, got %q and %q", cfg.Server.Authentication.Mode, cfg.Client.Authentication.Mode)
+	}
+	_, err = ReadConfigFromFS(fsys, "invalid.yaml")
+	testutil.AssertError(t, err, "invalid client.authentication.mode")
+}
+
+func TestBundleChangeHooks(t *testing.T) {
+	ctx, dir := watchContext(t)
+	resetCurrent(t)
+	t.Cleanup(func() { bundleChangeHooks = nil })
+
+	var calls int
+	AddBundleChangeHook(func() { calls++ })
+	if err := ReloadFromFile(ctx, log.NewNopLogger(), writeConfig(t, dir, "spiffe://example.org/client")); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 {
+		t.Errorf("expected the hook to be called once after a reload, got %d", calls)
+	}
+}
@@ -0,0 +1,195 @@
+package config
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/spiffetls/tlsconfig"
+
+	"github.com/jetstack/spiffe-demo/internal/pkg/identity"
+)
+
+// RevocationList describes a loaded CRL file.
+type RevocationList struct {
+	TrustDomain spiffeid.TrustDomain
+	Path        string
+	// NextUpdate is the earliest next update time of the CRLs in the file, after which
+	// a newer CRL should have been published. It is zero if none of the CRLs set one.
+	NextUpdate time.Time
+	// Revoked is the number of revoked certificates listed in the file.
+	Revoked int
+}
+
+// revocationList is a parsed CRL file, which may contain several CRLs.
+type revocationList struct {
+	RevocationList
+	// revoked maps the serials listed in any of the CRLs to the CRLs listing them
+	revoked map[string][]*x509.RevocationList
+}
+
+// loadRevocationList parses the PEM encoded CRLs, or a single DER encoded CRL, in the file at path.
+func loadRevocationList(td spiffeid.TrustDomain, path string) (*revocationList, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var ders [][]byte
+	for rest := data; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type == "X509 CRL" {
+			ders = append(ders, block.Bytes)
+		}
+	}
+	if len(ders) == 0 {
+		ders = [][]byte{data}
+	}
+
+	list := &revocationList{
+		RevocationList: RevocationList{TrustDomain: td, Path: path},
+		revoked:        make(map[string][]*x509.RevocationList),
+	}
+	for _, der := range ders {
+		crl, err := x509.ParseRevocationList(der)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CRL: %w", err)
+		}
+		for _, revoked := range crl.RevokedCertificateEntries {
+			serial := revoked.SerialNumber.Text(16)
+			list.revoked[serial] = append(list.revoked[serial], crl)
+		}
+		// A CRL without a next update time doesn't say when it will be replaced, so it never goes stale.
+		if nextUpdate := crl.NextUpdate; !nextUpdate.IsZero() && (list.NextUpdate.IsZero() || nextUpdate.Before(list.NextUpdate)) {
+			list.NextUpdate = nextUpdate
+		}
+	}
+	list.Revoked = len(list.revoked)
+	return list, nil
+}
+
+// revokes reports whether cert is listed in one of the CRLs issued by issuer. CRLs are only
+// trusted once their signature has been verified, so a CRL file can't revoke certificates
+// on behalf of a CA that didn't sign it.
+func (l *revocationList) revokes(cert, issuer *x509.Certificate) bool {
+	for _, crl := range l.revoked[identity.SerialString(cert)] {
+		if crl.CheckSignatureFrom(issuer) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// watchCRL loads the CRL file at path for the trust domain returned by trustDomain, and reloads
+// it whenever the file changes. Bundle change hooks are run after every reload, so that open
+// connections can be checked again. The returned function loads the CRL again.
+func (s *SpiffeDemoSource) watchCRL(ctx context.Context, path string, trustDomain func() (spiffeid.TrustDomain, error)) (func() error, error) {
+	var loaded spiffeid.TrustDomain
+	updateCRL := func() error {
+		td, err := trustDomain()
+		if err != nil {
+			return err
+		}
+		list, err := loadRevocationList(td, path)
+		if err != nil {
+			return fmt.Errorf("failed to load CRL for %q: %w", td, err)
+		}
+		if !list.NextUpdate.IsZero() && list.NextUpdate.Before(time.Now()) {
+			level.Warn(s.logger).Log("msg", "CRL is past its next update time", "file", path, "trust_domain", td, "next_update", list.NextUpdate)
+		}
+
+		s.crlsMu.Lock()
+		defer s.crlsMu.Unlock()
+		// the trust domain may have been derived from an SVID that has since changed
+		if !loaded.IsZero() && loaded != td {
+			delete(s.crls[loaded], path)
+		}
+		if s.crls[td] == nil {
+			s.crls[td] = make(map[string]*revocationList)
+		}
+		s.crls[td][path] = list
+		loaded = td
+		return nil
+	}
+	if err := updateCRL(); err != nil {
+		return nil, err
+	}
+	reloadCRL := func() error {
+		if err := updateCRL(); err != nil {
+			return err
+		}
+		runBundleChangeHooks()
+		return nil
+	}
+	if _, err := NewWatcher(ctx, s.logger, path, reloadCRL); err != nil {
+		return nil, fmt.Errorf("failed to start new config watcher: %w", err)
+	}
+	return reloadCRL, nil
+}
+
+// CheckRevocation returns an error if any certificate in verifiedChains, which were presented by
+// id, has been revoked by one of the CRLs loaded for id's trust domain.
+func (s *SpiffeDemoSource) CheckRevocation(id spiffeid.ID, verifiedChains [][]*x509.Certificate) error {
+	s.crlsMu.RLock()
+	lists := s.crls[id.TrustDomain()]
+	s.crlsMu.RUnlock()
+	if len(lists) == 0 {
+		return nil
+	}
+	for _, chain := range verifiedChains {
+		// The last certificate in a verified chain is the trusted root, which can't be revoked.
+		for i := 0; i+1 < len(chain); i++ {
+			for _, list := range lists {
+				if list.revokes(chain[i], chain[i+1]) {
+					kind := "leaf"
+					if i > 0 {
+						kind = "intermediate"
+					}
+					return fmt.Errorf("%s certificate with serial %s has been revoked by %s", kind, identity.SerialString(chain[i]), list.Path)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// RevocationLists returns the CRL files currently loaded, sorted by trust domain and path.
+func (s *SpiffeDemoSource) RevocationLists() []RevocationList {
+	s.crlsMu.RLock()
+	defer s.crlsMu.RUnlock()
+	var lists []RevocationList
+	for _, byPath := range s.crls {
+		for _, list := range byPath {
+			lists = append(lists, list.RevocationList)
+		}
+	}
+	sort.Slice(lists, func(i, j int) bool {
+		if lists[i].TrustDomain != lists[j].TrustDomain {
+			return lists[i].TrustDomain.String() < lists[j].TrustDomain.String()
+		}
+		return lists[i].Path < lists[j].Path
+	})
+	return lists
+}
+
+// AuthorizeUnrevoked rejects peers that presented a certificate revoked by one of the current
+// source's CRLs, logging their SPIFFE ID, and otherwise defers to authorizer.
+func AuthorizeUnrevoked(authorizer tlsconfig.Authorizer) tlsconfig.Authorizer {
+	return func(id spiffeid.ID, verifiedChains [][]*x509.Certificate) error {
+		source := GetCurrentSource()
+		if err := source.CheckRevocation(id, verifiedChains); err != nil {
+			level.Warn(source.logger).Log("msg", "rejected revoked certificate", "peer_id", id, "error", err)
+			return err
+		}
+		return authorizer(id, verifiedChains)
+	}
+}
@@ -0,0 +1,175 @@
+package config
+
+import (
+	"bytes"
+	"crypto/x509"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+
+	"github.com/jetstack/spiffe-demo/internal/pkg/identity"
+	"github.com/jetstack/spiffe-demo/internal/pkg/testutil"
+)
+
+// issueLeaf returns a certificate for id signed by ca.
+func issueLeaf(t *testing.T, ca *testutil.CA, id string) *x509.Certificate {
+	t.Helper()
+	cert, _ := ca.Issue(t, &x509.Certificate{
+		URIs:     []*url.URL{spiffeid.RequireFromString(id).URL()},
+		KeyUsage: x509.KeyUsageDigitalSignature,
+	})
+	return cert
+}
+
+func TestCheckRevocation(t *testing.T) {
+	td := spiffeid.RequireTrustDomainFromString("example.org")
+	root := testutil.NewCA(t)
+	intermediate := root.NewIntermediate(t)
+	revokedIntermediate := root.NewIntermediate(t)
+	rogue := testutil.NewCA(t)
+
+	revokedLeaf := issueLeaf(t, intermediate, "spiffe://example.org/revoked")
+	rogueRevokedLeaf := issueLeaf(t, intermediate, "spiffe://example.org/client")
+	nextUpdate := time.Now().Add(time.Hour)
+
+	dir := t.TempDir()
+	paths := []string{
+		testutil.WriteFile(t, dir, "root.crl", root.CRLPEM(t, nextUpdate, revokedIntermediate.Cert)),
+		testutil.WriteFile(t, dir, "intermediate.crl", intermediate.CRLPEM(t, nextUpdate, revokedLeaf)),
+		// A CRL that isn't signed by the certificate's issuer must be ignored.
+		testutil.WriteFile(t, dir, "rogue.crl", rogue.CRLPEM(t, nextUpdate, rogueRevokedLeaf)),
+	}
+	source := &SpiffeDemoSource{crls: map[spiffeid.TrustDomain]map[string]*revocationList{td: {}}}
+	for _, path := range paths {
+		list, err := loadRevocationList(td, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		source.crls[td][list.Path] = list
+	}
+
+	// The client classifies failed handshakes by the wording of these errors, see client.ClassifyFailure.
+	tests := map[string]struct {
+		id      string
+		chain   []*x509.Certificate
+		wantErr string
+	}{
+		"revoked leaf": {
+			id:      "spiffe://example.org/revoked",
+			chain:   []*x509.Certificate{revokedLeaf, intermediate.Cert, root.Cert},
+			wantErr: "leaf certificate with serial " + identity.SerialString(revokedLeaf) + " has been revoked by " + paths[1],
+		},
+		"revoked intermediate": {
+			id:      "spiffe://example.org/client",
+			chain:   []*x509.Certificate{issueLeaf(t, revokedIntermediate, "spiffe://example.org/client"), revokedIntermediate.Cert, root.Cert},
+			wantErr: "intermediate certificate with serial " + identity.SerialString(revokedIntermediate.Cert) + " has been revoked by " + paths[0],
+		},
+		"serial revoked by a CRL from another CA": {
+			id:    "spiffe://example.org/client",
+			chain: []*x509.Certificate{rogueRevokedLeaf, intermediate.Cert, root.Cert},
+		},
+		"unrevoked leaf": {
+			id:    "spiffe://example.org/client",
+			chain: []*x509.Certificate{issueLeaf(t, intermediate, "spiffe://example.org/client"), intermediate.Cert, root.Cert},
+		},
+		"no CRLs for the trust domain": {
+			id:    "spiffe://partner.example.com/client",
+			chain: []*x509.Certificate{revokedLeaf, intermediate.Cert, root.Cert},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := source.CheckRevocation(spiffeid.RequireFromString(test.id), [][]*x509.Certificate{test.chain})
+			testutil.AssertError(t, err, test.wantErr)
+		})
+	}
+}
+
+func TestLoadRevocationList(t *testing.T) {
+	td := spiffeid.RequireTrustDomainFromString("example.org")
+	ca := testutil.NewCA(t)
+	first, second := issueLeaf(t, ca, "spiffe://example.org/first"), issueLeaf(t, ca, "spiffe://example.org/second")
+	earlier, later := time.Now().Add(time.Hour).Truncate(time.Second), time.Now().Add(2*time.Hour)
+	dir := t.TempDir()
+
+	tests := map[string]struct {
+		data           []byte
+		wantRevoked    int
+		wantNextUpdate time.Time
+		wantErr        string
+	}{
+		"PEM": {
+			data:           ca.CRLPEM(t, earlier, first, second),
+			wantRevoked:    2,
+			wantNextUpdate: earlier,
+		},
+		"several CRLs": {
+			data:           append(ca.CRLPEM(t, later, first), ca.CRLPEM(t, earlier, second)...),
+			wantRevoked:    2,
+			wantNextUpdate: earlier,
+		},
+		"no next update": {
+			data:        ca.CRLPEM(t, time.Time{}, first),
+			wantRevoked: 1,
+		},
+		"only some CRLs with a next update": {
+			data:           append(ca.CRLPEM(t, time.Time{}, first), ca.CRLPEM(t, earlier, second)...),
+			wantRevoked:    2,
+			wantNextUpdate: earlier,
+		},
+		"invalid": {
+			data:    []byte("not a CRL"),
+			wantErr: "failed to parse CRL",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			list, err := loadRevocationList(td, testutil.WriteFile(t, dir, name+".crl", test.data))
+			testutil.AssertError(t, err, test.wantErr)
+			if err != nil {
+				return
+			}
+			if list.Revoked != test.wantRevoked {
+				t.Errorf("expected %d revoked certificates, got %d", test.wantRevoked, list.Revoked)
+			}
+			if !list.NextUpdate.Equal(test.wantNextUpdate) {
+				t.Errorf("expected next update %s, got %s", test.wantNextUpdate, list.NextUpdate)
+			}
+		})
+	}
+}
+
+func TestWatchCRLWarnsWhenStale(t *testing.T) {
+	ctx, dir := watchContext(t)
+	td := spiffeid.RequireTrustDomainFromString("example.org")
+	ca := testutil.NewCA(t)
+
+	tests := map[string]struct {
+		nextUpdate time.Time
+		wantWarn   bool
+	}{
+		"stale":          {nextUpdate: time.Now().Add(-time.Second), wantWarn: true},
+		"current":        {nextUpdate: time.Now().Add(time.Hour)},
+		"no next update": {},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var logs bytes.Buffer
+			source := &SpiffeDemoSource{
+				logger: log.NewLogfmtLogger(&logs),
+				crls:   make(map[spiffeid.TrustDomain]map[string]*revocationList),
+			}
+			path := testutil.WriteFile(t, dir, name+".crl", ca.CRLPEM(t, test.nextUpdate))
+			if _, err := source.watchCRL(ctx, path, func() (spiffeid.TrustDomain, error) { return td, nil }); err != nil {
+				t.Fatal(err)
+			}
+			if warned := strings.Contains(logs.String(), "CRL is past its next update time"); warned != test.wantWarn {
+				t.Errorf("expected a stale CRL warning to be logged: %t, got logs %q", test.wantWarn, logs.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package config
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/go-kit/log/level"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/spiffetls/tlsconfig"
+	"gopkg.in/yaml.v2"
+
+	"github.com/jetstack/spiffe-demo/types"
+)
+
+// denyObserver is called with the matching entry every time a peer is denied by a deny list
+var denyObserver atomic.Value // func(entry string, id spiffeid.ID)
+
+// SetDenyObserver registers a function that is called with the matching entry and the peer's
+// SPIFFE ID every time a peer is denied by the deny list, for example to count denials.
+// Only the most recently registered observer is called.
+func SetDenyObserver(observer func(entry string, id spiffeid.ID)) {
+	denyObserver.Store(observer)
+}
+
+// denyList is a validated types.DenyList
+type denyList struct {
+	ids          map[spiffeid.ID]struct{}
+	pathPrefixes []string
+}
+
+// loadDenyList reads and validates the deny list file at path.
+func loadDenyList(path string) (*denyList, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file types.DenyList
+	if err := yaml.UnmarshalStrict(raw, &file); err != nil {
+		return nil, err
+	}
+
+	list := &denyList{
+		ids:          make(map[spiffeid.ID]struct{}, len(file.IDs)),
+		pathPrefixes: file.PathPrefixes,
+	}
+	for _, id := range file.IDs {
+		spiffeID, err := spiffeid.FromString(id)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SPIFFE ID %q: %w", id, err)
+		}
+		list.ids[spiffeID] = struct{}{}
+	}
+	for _, prefix := range file.PathPrefixes {
+		if !strings.HasPrefix(prefix, "/") {
+			return nil, fmt.Errorf("path prefix %q must start with /", prefix)
+		}
+	}
+	return list, nil
+}
+
+// denies returns the entry in the list matching id, if there is one.
+func (l *denyList) denies(id spiffeid.ID) (string, bool) {
+	if _, ok := l.ids[id]; ok {
+		return id.String(), true
+	}
+	for _, prefix := range l.pathPrefixes {
+		if strings.HasPrefix(id.Path(), prefix) {
+			return prefix, true
+		}
+	}
+	return "", false
+}
+
+// watchDenyList loads the deny list file at path, and reloads it whenever the file changes.
+// Bundle change hooks are run after every reload, so that open connections can be checked again.
+func (s *SpiffeDemoSource) watchDenyList(ctx context.Context, path string) error {
+	updateDenyList := func() error {
+		list, err := loadDenyList(path)
+		if err != nil {
+			return fmt.Errorf("failed to load deny list: %w", err)
+		}
+		s.denyList.Store(list)
+		return nil
+	}
+	if err := updateDenyList(); err != nil {
+		return err
+	}
+	reloadDenyList := func() error {
+		if err := updateDenyList(); err != nil {
+			return err
+		}
+		level.Info(s.logger).Log("msg", "reloaded deny list", "file", path)
+		runBundleChangeHooks()
+		return nil
+	}
+	if _, err := NewWatcher(ctx, s.logger, path, reloadDenyList); err != nil {
+		return fmt.Errorf("failed to start new config watcher: %w", err)
+	}
+	return nil
+}
+
+// CheckDenied returns an error if id is on the deny list, reporting the denial to the observer.
+func (s *SpiffeDemoSource) CheckDenied(id spiffeid.ID) error {
+	list, ok := s.denyList.Load().(*denyList)
+	if !ok {
+		return nil
+	}
+	entry, denied := list.denies(id)
+	if !denied {
+		return nil
+	}
+	if observer, ok := denyObserver.Load().(func(string, spiffeid.ID)); ok {
+		observer(entry, id)
+	}
+	return fmt.Errorf("%s is on the deny list (%s)", id, entry)
+}
+
+// AuthorizeNotDenied rejects peers whose SPIFFE ID is on the current source's deny list, logging
+// their SPIFFE ID, and otherwise defers to authorizer.
+func AuthorizeNotDenied(authorizer tlsconfig.Authorizer) tlsconfig.Authorizer {
+	return func(id spiffeid.ID, verifiedChains [][]*x509.Certificate) error {
+		source := GetCurrentSource()
+		if err := source.CheckDenied(id); err != nil {
+			level.Warn(source.logger).Log("msg", "rejected denied peer", "peer_id", id, "error", err)
+			return err
+		}
+		return authorizer(id, verifiedChains)
+	}
+}
@@ -0,0 +1,112 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+
+	"github.com/jetstack/spiffe-demo/internal/pkg/testutil"
+)
+
+func writeDenyList(t *testing.T, content string) string {
+	t.Helper()
+	return testutil.WriteFile(t, t.TempDir(), "deny-list.yaml", []byte(content))
+}
+
+func TestLoadDenyListRejectsInvalidFiles(t *testing.T) {
+	tests := map[string]struct {
+		content string
+		wantErr string
+	}{
+		"invalid SPIFFE ID": {
+			content: "ids: [example.org/client]\n",
+			wantErr: `invalid SPIFFE ID "example.org/client"`,
+		},
+		"path prefix without a slash": {
+			content: "path_prefixes: [ns/]\n",
+			wantErr: `path prefix "ns/" must start with /`,
+		},
+		"unknown field": {
+			content: "path_prefix: [/ns/]\n",
+			wantErr: "field path_prefix not found",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := loadDenyList(writeDenyList(t, test.content))
+			testutil.AssertError(t, err, test.wantErr)
+		})
+	}
+}
+
+func TestDenyListDenies(t *testing.T) {
+	list, err := loadDenyList(writeDenyList(t, `
+ids:
+  - spiffe://example.org/ns/default/sa/client
+path_prefixes:
+  - /ns/compromised/
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		id         string
+		wantEntry  string
+		wantDenied bool
+	}{
+		"exact ID": {
+			id:         "spiffe://example.org/ns/default/sa/client",
+			wantEntry:  "spiffe://example.org/ns/default/sa/client",
+			wantDenied: true,
+		},
+		"same path in another trust domain": {
+			id: "spiffe://partner.example.com/ns/default/sa/client",
+		},
+		"path prefix in any trust domain": {
+			id:         "spiffe://partner.example.com/ns/compromised/sa/client",
+			wantEntry:  "/ns/compromised/",
+			wantDenied: true,
+		},
+		"prefix is not a path segment match": {
+			id: "spiffe://example.org/ns/compromised-not/sa/client",
+		},
+		"other ID": {
+			id: "spiffe://example.org/ns/default/sa/server",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			entry, denied := list.denies(spiffeid.RequireFromString(test.id))
+			if entry != test.wantEntry || denied != test.wantDenied {
+				t.Errorf("expected (%q, %t), got (%q, %t)", test.wantEntry, test.wantDenied, entry, denied)
+			}
+		})
+	}
+}
+
+func TestCheckDenied(t *testing.T) {
+	list, err := loadDenyList(writeDenyList(t, "path_prefixes: [/ns/compromised/]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := &SpiffeDemoSource{}
+	id := spiffeid.RequireFromString("spiffe://example.org/ns/compromised/sa/client")
+	if err := source.CheckDenied(id); err != nil {
+		t.Fatalf("expected no error without a deny list, got %v", err)
+	}
+
+	source.denyList.Store(list)
+	var observed []string
+	SetDenyObserver(func(entry string, id spiffeid.ID) { observed = append(observed, entry) })
+	t.Cleanup(func() { SetDenyObserver(func(string, spiffeid.ID) {}) })
+	err = source.CheckDenied(id)
+	// The client classifies failed handshakes by this wording, see client.ClassifyFailure.
+	testutil.AssertError(t, err, "spiffe://example.org/ns/compromised/sa/client is on the deny list (/ns/compromised/)")
+	if err := source.CheckDenied(spiffeid.RequireFromString("spiffe://example.org/ns/default/sa/client")); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if len(observed) != 1 || observed[0] != "/ns/compromised/" {
+		t.Errorf("expected the denial to be observed once, got %v", observed)
+	}
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/bundle/jwtbundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/svid/jwtsvid"
+)
+
+// Interface guards
+var _ jwtsvid.Source = &SpiffeDemoSource{}
+var _ jwtbundle.Source = &SpiffeDemoSource{}
+
+// FetchJWTSVID returns a JWT-SVID for the given audience. When reading from files the token is
+// minted ahead of time, so the requested audiences and subject must already be present in it.
+func (s *SpiffeDemoSource) FetchJWTSVID(ctx context.Context, params jwtsvid.Params) (*jwtsvid.SVID, error) {
+	if s.workloadAPIJWTSource != nil {
+		return s.workloadAPIJWTSource.FetchJWTSVID(ctx, params)
+	}
+	svid, ok := s.currentJWTSVID.Load().(*jwtsvid.SVID)
+	if !ok || svid == nil {
+		return nil, errors.New("no JWT-SVID loaded")
+	}
+	if !params.Subject.IsZero() && params.Subject != svid.ID {
+		return nil, fmt.Errorf("JWT-SVID has subject %q, not %q", svid.ID, params.Subject)
+	}
+	for _, audience := range append([]string{params.Audience}, params.ExtraAudiences...) {
+		if !containsString(svid.Audience, audience) {
+			return nil, fmt.Errorf("JWT-SVID is not valid for audience %q", audience)
+		}
+	}
+	if time.Now().After(svid.Expiry) {
+		return nil, fmt.Errorf("JWT-SVID expired at %s", svid.Expiry)
+	}
+	return svid, nil
+}
+
+func (s *SpiffeDemoSource) GetJWTBundleForTrustDomain(trustDomain spiffeid.TrustDomain) (*jwtbundle.Bundle, error) {
+	if s.workloadAPIJWTSource != nil {
+		return s.workloadAPIJWTSource.GetJWTBundleForTrustDomain(trustDomain)
+	}
+	if s.jwtBundles == nil {
+		return nil, errors.New("no JWT bundles loaded")
+	}
+	return s.jwtBundles.GetJWTBundleForTrustDomain(trustDomain)
+}
+
+// watchJWTSVID loads the JWT-SVID token at path and reloads it whenever the file changes.
+// The token's signature is not verified, as it is our own token to present to others.
+func (s *SpiffeDemoSource) watchJWTSVID(ctx context.Context, path string) error {
+	updateJWTSVID := func() error {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read JWT-SVID: %w", err)
+		}
+		svid, err := jwtsvid.ParseInsecure(strings.TrimSpace(string(raw)), nil)
+		if err != nil {
+			return fmt.Errorf("failed to parse JWT-SVID: %w", err)
+		}
+		s.currentJWTSVID.Store(svid)
+		return nil
+	}
+	if err := updateJWTSVID(); err != nil {
+		return err
+	}
+	if _, err := NewWatcher(ctx, s.logger, path, updateJWTSVID); err != nil {
+		return fmt.Errorf("failed to start new config watcher: %w", err)
+	}
+	return nil
+}
+
+// watchJWTBundle loads the JWT bundle at path into the source's JWT bundle set, and reloads it
+// whenever the file changes. The returned function loads the bundle again.
+func (s *SpiffeDemoSource) watchJWTBundle(ctx context.Context, path string, trustDomain func() (spiffeid.TrustDomain, error)) (func() error, error) {
+	var loaded spiffeid.TrustDomain
+	updateJWTBundle := func() error {
+		td, err := trustDomain()
+		if err != nil {
+			return err
+		}
+		bundle, err := loadJWTBundle(td, path)
+		if err != nil {
+			return fmt.Errorf("failed to load JWT bundle for %q: %w", td, err)
+		}
+		if !loaded.IsZero() && loaded != td {
+			s.jwtBundles.Remove(loaded)
+		}
+		s.jwtBundles.Add(bundle)
+		loaded = td
+		return nil
+	}
+	if err := updateJWTBundle(); err != nil {
+		return nil, err
+	}
+	if _, err := NewWatcher(ctx, s.logger, path, updateJWTBundle); err != nil {
+		return nil, fmt.Errorf("failed to start new config watcher: %w", err)
+	}
+	return updateJWTBundle, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/svid/jwtsvid"
+
+	"github.com/jetstack/spiffe-demo/internal/pkg/testutil"
+)
+
+func TestFetchJWTSVID(t *testing.T) {
+	authority := testutil.NewJWTAuthority(t, "key-1")
+	id := "spiffe://example.org/client"
+	valid := authority.Sign(t, id, []string{"server", "proxy"}, time.Now().Add(time.Hour))
+
+	tests := map[string]struct {
+		token   string
+		expired bool
+		params  jwtsvid.Params
+		wantErr string
+	}{
+		"valid": {
+			token:  valid,
+			params: jwtsvid.Params{Audience: "server"},
+		},
+		"matching subject": {
+			token:  valid,
+			params: jwtsvid.Params{Audience: "server", Subject: spiffeid.RequireFromString(id)},
+		},
+		"extra audiences": {
+			token:  valid,
+			params: jwtsvid.Params{Audience: "server", ExtraAudiences: []string{"proxy"}},
+		},
+		"other subject": {
+			token:   valid,
+			params:  jwtsvid.Params{Audience: "server", Subject: spiffeid.RequireFromString("spiffe://example.org/other")},
+			wantErr: `JWT-SVID has subject "spiffe://example.org/client", not "spiffe://example.org/other"`,
+		},
+		"other audience": {
+			token:   valid,
+			params:  jwtsvid.Params{Audience: "other"},
+			wantErr: `JWT-SVID is not valid for audience "other"`,
+		},
+		"missing extra audience": {
+			token:   valid,
+			params:  jwtsvid.Params{Audience: "server", ExtraAudiences: []string{"other"}},
+			wantErr: `JWT-SVID is not valid for audience "other"`,
+		},
+		"expired since it was loaded": {
+			token:   valid,
+			expired: true,
+			params:  jwtsvid.Params{Audience: "server"},
+			wantErr: "JWT-SVID expired at",
+		},
+		"no JWT-SVID": {
+			params:  jwtsvid.Params{Audience: "server"},
+			wantErr: "no JWT-SVID loaded",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			source := new(SpiffeDemoSource)
+			if len(test.token) > 0 {
+				svid, err := jwtsvid.ParseInsecure(test.token, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if test.expired {
+					svid.Expiry = time.Now().Add(-time.Minute)
+				}
+				source.currentJWTSVID.Store(svid)
+			}
+			svid, err := source.FetchJWTSVID(context.Background(), test.params)
+			testutil.AssertError(t, err, test.wantErr)
+			if err == nil && svid.Marshal() != test.token {
+				t.Error("expected the loaded JWT-SVID")
+			}
+		})
+	}
+}
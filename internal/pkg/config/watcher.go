@@ -2,15 +2,42 @@ package config
 
 import (
 	"context"
-	"log"
+	"os"
+	"sync/atomic"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
 )
 
+// reloadObserver is called with the result of every reload performed by a Watcher
+var reloadObserver atomic.Value // func(path string, err error)
+
+// SetReloadObserver registers a function that is called with the watched file and the
+// result every time a Watcher runs its actions, for example to count failed reloads.
+// Only the most recently registered observer is called.
+func SetReloadObserver(observer func(path string, err error)) {
+	reloadObserver.Store(observer)
+}
+
+func observeReload(path string, errs []error) {
+	observer, ok := reloadObserver.Load().(func(string, error))
+	if !ok {
+		return
+	}
+	var err error
+	if len(errs) > 0 {
+		err = errs[0]
+	}
+	observer(path, err)
+}
+
 // Watcher is an opinionated fsnotify.Watcher that is designed to
 // watch Kubernetes config maps and perform actions on change.
 type Watcher struct {
+	logger  log.Logger
+	path    string
 	actions []func() error
 	notify  chan struct{}
 }
@@ -22,8 +49,12 @@ func (w *Watcher) Notify() {
 	}(w)
 }
 
-func NewWatcher(ctx context.Context, filePath string, actions ...func() error) (*Watcher, error) {
+// NewWatcher starts watching filePath, running actions whenever it changes. Failed actions are
+// logged to logger and retried until they succeed.
+func NewWatcher(ctx context.Context, logger log.Logger, filePath string, actions ...func() error) (*Watcher, error) {
 	w := &Watcher{
+		logger:  log.With(logger, "file", filePath),
+		path:    filePath,
 		actions: actions,
 		notify:  make(chan struct{}),
 	}
@@ -56,16 +87,18 @@ func NewWatcher(ctx context.Context, filePath string, actions ...func() error) (
 			select {
 			case <-w.notify:
 				allErrors := runAll(w.actions...)
+				observeReload(w.path, allErrors)
 				for _, e := range allErrors {
-					log.Printf("error while reloading config (%s)", e.Error())
+					level.Error(w.logger).Log("msg", "error while reloading config", "error", e)
 				}
 			case <-t.C:
 				if lastEvent == nil {
 					continue
 				}
 				allErrors := runAll(w.actions...)
+				observeReload(w.path, allErrors)
 				for _, e := range allErrors {
-					log.Printf("error while reloading file %s (%s)", lastEvent.Name, e.Error())
+					level.Error(w.logger).Log("msg", "error while reloading file", "error", e)
 				}
 				// if no errors, clear the last event.
 				if len(allErrors) == 0 {
@@ -84,7 +117,8 @@ func NewWatcher(ctx context.Context, filePath string, actions ...func() error) (
 					_ = watcher.Remove(event.Name)
 					err := watcher.Add(event.Name)
 					if err != nil {
-						log.Fatalf("file %s change detected, but could not re-watch the file: %s", event.Name, err.Error())
+						level.Error(w.logger).Log("msg", "file change detected, but could not re-watch the file", "error", err)
+						os.Exit(1)
 					}
 					lastEvent = &event
 				}
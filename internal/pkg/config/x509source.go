@@ -2,13 +2,18 @@ package config
 
 import (
 	"context"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"os"
+	"sync"
 	"sync/atomic"
 
+	"github.com/go-kit/log"
+	"github.com/spiffe/go-spiffe/v2/bundle/jwtbundle"
 	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
 	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/svid/jwtsvid"
 	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
 	"github.com/spiffe/go-spiffe/v2/workloadapi"
 
@@ -19,34 +24,69 @@ import (
 var _ x509svid.Source = &SpiffeDemoSource{}
 var _ x509bundle.Source = &SpiffeDemoSource{}
 
-// SpiffeDemoSource implements x509svid.Source and x509bundle.Source by either
-// reading files or communicating with the SPIRE workload API.
+// SpiffeDemoSource implements x509svid.Source, x509bundle.Source, jwtsvid.Source and
+// jwtbundle.Source by either reading files or communicating with the SPIRE workload API.
 type SpiffeDemoSource struct {
 	cancelFunc context.CancelFunc
+	logger     log.Logger
 
-	workloadAPISource *workloadapi.X509Source
+	workloadAPIClient    *workloadapi.Client
+	workloadAPISource    *workloadapi.X509Source
+	workloadAPIJWTSource *workloadapi.JWTSource
 
-	currentSVID        atomic.Value // *x509svid.SVID
-	currentTrustBundle atomic.Value // *x509bundle.Bundle
+	currentSVID    atomic.Value // *x509svid.SVID
+	currentJWTSVID atomic.Value // *jwtsvid.SVID
+	trustBundles   *x509bundle.Set
+	// jwtBundles holds the JWT authorities of any trust bundles loaded in SPIFFE bundle format
+	jwtBundles *jwtbundle.Set
+
+	denyList atomic.Value // *denyList
+
+	crlsMu sync.RWMutex
+	// crls holds the CRL files loaded for each trust domain, by path
+	crls map[spiffeid.TrustDomain]map[string]*revocationList
 }
 
 // ConstructSpiffeDemoSource constructs a new SPIFFE Connector source ready to become the current source.
 // When disposing of the source be sure to cancel the Context, as this will clean up the fsnotify watchers.
-func ConstructSpiffeDemoSource(ctx context.Context, cancel context.CancelFunc, config *types.SpiffeConfig) (*SpiffeDemoSource, error) {
+// Errors reloading watched files are logged to logger.
+func ConstructSpiffeDemoSource(ctx context.Context, cancel context.CancelFunc, logger log.Logger, config *types.SpiffeConfig) (*SpiffeDemoSource, error) {
 	source := &SpiffeDemoSource{
-		cancelFunc: cancel,
+		cancelFunc:   cancel,
+		logger:       logger,
+		trustBundles: x509bundle.NewSet(),
+		jwtBundles:   jwtbundle.NewSet(),
+		crls:         make(map[spiffeid.TrustDomain]map[string]*revocationList),
 	}
 	if config == nil {
 		return nil, errors.New("no SPIFFE config provided")
 	}
+	if len(config.DenyList) > 0 {
+		if err := source.watchDenyList(ctx, config.DenyList); err != nil {
+			return nil, err
+		}
+	}
 
 	// If Workload API is set, just use that.
 	if config.SVIDSources.WorkloadAPI != nil {
-		x509source, err := workloadapi.NewX509Source(ctx, workloadapi.WithClientOptions(workloadapi.WithAddr(config.SVIDSources.WorkloadAPI.SocketPath)))
+		client, err := workloadapi.New(ctx, workloadapi.WithAddr(config.SVIDSources.WorkloadAPI.SocketPath))
+		if err != nil {
+			return nil, err
+		}
+		source.workloadAPIClient = client
+		x509source, err := workloadapi.NewX509Source(ctx, workloadapi.WithClient(client))
 		if err != nil {
+			client.Close()
 			return nil, err
 		}
 		source.workloadAPISource = x509source
+		jwtSource, err := workloadapi.NewJWTSource(ctx, workloadapi.WithClient(client))
+		if err != nil {
+			x509source.Close()
+			client.Close()
+			return nil, err
+		}
+		source.workloadAPIJWTSource = jwtSource
 		return source, nil
 	}
 
@@ -60,11 +100,30 @@ func ConstructSpiffeDemoSource(ctx context.Context, cancel context.CancelFunc, c
 		}
 		source.currentSVID.Store(svid)
 
-		bundle, err := x509bundle.Parse(spiffeid.RequireTrustDomainFromString("todo"), config.SVIDSources.InMemory.TrustDomainCA)
+		trustDomain, err := bundleTrustDomain(config.SVIDSources.InMemory.TrustDomain, svid)
+		if err != nil {
+			return source, err
+		}
+		bundle, err := x509bundle.Parse(trustDomain, config.SVIDSources.InMemory.TrustDomainCA)
 		if err != nil {
 			return source, err
 		}
-		source.currentTrustBundle.Store(bundle)
+		source.trustBundles.Add(bundle)
+
+		if len(config.SVIDSources.InMemory.JWTSVID) > 0 {
+			jwtSVID, err := jwtsvid.ParseInsecure(config.SVIDSources.InMemory.JWTSVID, nil)
+			if err != nil {
+				return source, err
+			}
+			source.currentJWTSVID.Store(jwtSVID)
+		}
+		if len(config.SVIDSources.InMemory.JWTBundle) > 0 {
+			jwtBundle, err := jwtbundle.Parse(trustDomain, config.SVIDSources.InMemory.JWTBundle)
+			if err != nil {
+				return source, err
+			}
+			source.jwtBundles.Add(jwtBundle)
+		}
 
 		return source, nil
 	}
@@ -78,7 +137,10 @@ func ConstructSpiffeDemoSource(ctx context.Context, cancel context.CancelFunc, c
 	}
 
 	source.currentSVID.Store(new(x509svid.SVID))
-	source.currentTrustBundle.Store(new(x509bundle.Bundle))
+
+	// Unless a trust domain is configured, the trust bundle and CRLs are loaded for the SVID's trust
+	// domain, so they are reloaded whenever a rotated SVID is in a different trust domain.
+	var reloadForTrustDomain []func() error
 
 	// Start watching for SVID updates
 	updateSVID := func() error {
@@ -92,30 +154,100 @@ func ConstructSpiffeDemoSource(ctx context.Context, cancel context.CancelFunc, c
 		if svid == nil {
 			return errors.New("no SVID provided in config file")
 		}
-		source.currentSVID.Store(svid)
+		previous := source.currentSVID.Swap(svid).(*x509svid.SVID)
+		if len(config.SVIDSources.Files.TrustDomain) == 0 && !previous.ID.IsZero() && previous.ID.TrustDomain() != svid.ID.TrustDomain() {
+			for _, reload := range reloadForTrustDomain {
+				if err := reload(); err != nil {
+					return err
+				}
+			}
+		}
 		return nil
 	}
 	if err := updateSVID(); err != nil {
 		return nil, err
 	}
-	if _, err := NewWatcher(ctx, config.SVIDSources.Files.SVIDKey, updateSVID); err != nil {
+	if _, err := NewWatcher(ctx, logger, config.SVIDSources.Files.SVIDKey, updateSVID); err != nil {
 		return nil, err
 	}
 
-	// Start watching for Trust bundle updates
-	updateTrustBundle := func() error {
-		bundle, err := x509bundle.Load(spiffeid.RequireTrustDomainFromString("todo"), config.SVIDSources.Files.TrustDomainCA)
+	// Start watching for Trust bundle updates, with a separate watcher for each bundle file
+	files := config.SVIDSources.Files
+	if len(files.TrustDomainCA) == 0 && len(files.FederatedTrustDomainCAs) == 0 {
+		return nil, errors.New("no trust bundles provided in config file")
+	}
+	federatedTrustDomains := make(map[spiffeid.TrustDomain]string, len(files.FederatedTrustDomainCAs))
+	for name, path := range files.FederatedTrustDomainCAs {
+		trustDomain, err := spiffeid.TrustDomainFromString(name)
 		if err != nil {
-			return fmt.Errorf("failed to load trust bundle: %w", err)
+			return nil, fmt.Errorf("invalid federated trust domain %q: %w", name, err)
 		}
-		source.currentTrustBundle.Store(bundle)
-		return nil
+		federatedTrustDomains[trustDomain] = path
 	}
-	if err := updateTrustBundle(); err != nil {
-		return nil, err
+	// The trust domain may be derived from the SVID, so it is checked against the federated
+	// trust domains every time it is used, in case a rotated SVID is in one of them.
+	ownTrustDomain := func() (spiffeid.TrustDomain, error) {
+		td, err := bundleTrustDomain(files.TrustDomain, source.currentSVID.Load().(*x509svid.SVID))
+		if err != nil {
+			return td, err
+		}
+		if _, federated := federatedTrustDomains[td]; federated {
+			return spiffeid.TrustDomain{}, fmt.Errorf("trust domain %q is configured as both the trust domain and a federated trust domain", td)
+		}
+		return td, nil
 	}
-	if _, err := NewWatcher(ctx, config.SVIDSources.Files.TrustDomainCA, updateTrustBundle); err != nil {
-		return nil, fmt.Errorf("failed to start new config watcher: %w", err)
+	if len(files.TrustDomainCA) > 0 {
+		reload, err := source.watchTrustBundle(ctx, files.TrustDomainCA, ownTrustDomain, len(files.JWTBundle) == 0)
+		if err != nil {
+			return nil, err
+		}
+		reloadForTrustDomain = append(reloadForTrustDomain, reload)
+	}
+	for trustDomain, path := range federatedTrustDomains {
+		trustDomain := trustDomain
+		_, err := source.watchTrustBundle(ctx, path, func() (spiffeid.TrustDomain, error) {
+			return trustDomain, nil
+		}, true)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Start watching for revocation list updates, with a separate watcher for each CRL file
+	for _, path := range files.CRLs {
+		reload, err := source.watchCRL(ctx, path, ownTrustDomain)
+		if err != nil {
+			return nil, err
+		}
+		reloadForTrustDomain = append(reloadForTrustDomain, reload)
+	}
+	for name, paths := range files.FederatedCRLs {
+		trustDomain, err := spiffeid.TrustDomainFromString(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid federated trust domain %q: %w", name, err)
+		}
+		for _, path := range paths {
+			_, err := source.watchCRL(ctx, path, func() (spiffeid.TrustDomain, error) {
+				return trustDomain, nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Start watching for JWT-SVID and JWT bundle updates, if configured
+	if len(files.JWTBundle) > 0 {
+		reload, err := source.watchJWTBundle(ctx, files.JWTBundle, ownTrustDomain)
+		if err != nil {
+			return nil, err
+		}
+		reloadForTrustDomain = append(reloadForTrustDomain, reload)
+	}
+	if len(files.JWTSVID) > 0 {
+		if err := source.watchJWTSVID(ctx, files.JWTSVID); err != nil {
+			return nil, err
+		}
 	}
 	return source, nil
 }
@@ -124,21 +256,130 @@ func (s *SpiffeDemoSource) GetX509SVID() (*x509svid.SVID, error) {
 	if s.workloadAPISource != nil {
 		return s.workloadAPISource.GetX509SVID()
 	}
-	return s.currentSVID.Load().(*x509svid.SVID), nil
+	svid, ok := s.currentSVID.Load().(*x509svid.SVID)
+	if !ok || svid == nil || len(svid.Certificates) == 0 {
+		return nil, errors.New("no SVID loaded")
+	}
+	return svid, nil
 }
 
 func (s *SpiffeDemoSource) GetX509BundleForTrustDomain(trustDomain spiffeid.TrustDomain) (*x509bundle.Bundle, error) {
 	if s.workloadAPISource != nil {
 		return s.workloadAPISource.GetX509BundleForTrustDomain(trustDomain)
 	}
-	return s.currentTrustBundle.Load().(*x509bundle.Bundle), nil
+	if s.trustBundles == nil {
+		return nil, errors.New("no trust bundles loaded")
+	}
+	// The set returns an error for any trust domain it has no bundle for, so that a CA
+	// can never be used to verify SVIDs from a different trust domain.
+	return s.trustBundles.GetX509BundleForTrustDomain(trustDomain)
+}
+
+// X509Bundles returns the X.509 bundles currently loaded. The workload API doesn't list
+// the trust domains it has bundles for, so only the bundle for the SVID's own trust
+// domain is returned in that case.
+func (s *SpiffeDemoSource) X509Bundles() []*x509bundle.Bundle {
+	if s.workloadAPISource != nil {
+		svid, err := s.workloadAPISource.GetX509SVID()
+		if err != nil {
+			return nil
+		}
+		bundle, err := s.workloadAPISource.GetX509BundleForTrustDomain(svid.ID.TrustDomain())
+		if err != nil {
+			return nil
+		}
+		return []*x509bundle.Bundle{bundle}
+	}
+	if s.trustBundles == nil {
+		return nil
+	}
+	return s.trustBundles.Bundles()
 }
 
+// Cancel stops any watchers started by the source and closes its connection to the workload API.
+// It is safe to call on a zero SpiffeDemoSource.
 func (s *SpiffeDemoSource) Cancel() {
-	s.cancelFunc()
+	if s.cancelFunc != nil {
+		s.cancelFunc()
+	}
+	// The sources don't own the client, so it has to be closed separately.
+	if s.workloadAPIJWTSource != nil {
+		s.workloadAPIJWTSource.Close()
+	}
+	if s.workloadAPISource != nil {
+		s.workloadAPISource.Close()
+	}
+	if s.workloadAPIClient != nil {
+		s.workloadAPIClient.Close()
+	}
 }
 
-// DynamicSource represents the most up-to-date SVID / Trust bundle we have
+// watchTrustBundle loads the trust bundle at path into the source's bundle sets, and reloads it
+// whenever the file changes. trustDomain is called on every load to determine which trust
+// domain the bundle belongs to. JWT authorities in the bundle are only used if withJWT is set.
+// The returned function loads the bundle again.
+func (s *SpiffeDemoSource) watchTrustBundle(ctx context.Context, path string, trustDomain func() (spiffeid.TrustDomain, error), withJWT bool) (func() error, error) {
+	var loaded spiffeid.TrustDomain
+	updateTrustBundle := func() error {
+		td, err := trustDomain()
+		if err != nil {
+			return err
+		}
+		bundle, jwtBundle, err := loadTrustBundle(td, path)
+		if err != nil {
+			return fmt.Errorf("failed to load trust bundle for %q: %w", td, err)
+		}
+		// the trust domain may have been derived from an SVID that has since changed
+		if !loaded.IsZero() && loaded != td {
+			s.trustBundles.Remove(loaded)
+			if withJWT {
+				s.jwtBundles.Remove(loaded)
+			}
+		}
+		s.trustBundles.Add(bundle)
+		if withJWT {
+			if jwtBundle != nil {
+				s.jwtBundles.Add(jwtBundle)
+			} else {
+				s.jwtBundles.Remove(td)
+			}
+		}
+		loaded = td
+		return nil
+	}
+	if err := updateTrustBundle(); err != nil {
+		return nil, err
+	}
+	reloadTrustBundle := func() error {
+		if err := updateTrustBundle(); err != nil {
+			return err
+		}
+		runBundleChangeHooks()
+		return nil
+	}
+	if _, err := NewWatcher(ctx, s.logger, path, reloadTrustBundle); err != nil {
+		return nil, fmt.Errorf("failed to start new config watcher: %w", err)
+	}
+	return reloadTrustBundle, nil
+}
+
+// bundleTrustDomain returns the trust domain a trust bundle should be loaded for. If no trust
+// domain was configured, the trust domain of the SVID is used.
+func bundleTrustDomain(configured string, svid *x509svid.SVID) (spiffeid.TrustDomain, error) {
+	if len(configured) > 0 {
+		trustDomain, err := spiffeid.TrustDomainFromString(configured)
+		if err != nil {
+			return spiffeid.TrustDomain{}, fmt.Errorf("invalid trust domain %q: %w", configured, err)
+		}
+		return trustDomain, nil
+	}
+	if svid.ID.IsZero() {
+		return spiffeid.TrustDomain{}, errors.New("no trust domain configured and no SVID to take it from")
+	}
+	return svid.ID.TrustDomain(), nil
+}
+
+// DynamicSource represents the most up-to-date SVIDs / Trust bundles we have
 // from the most recently loaded source config file
 type DynamicSource struct{}
 
@@ -149,3 +390,27 @@ func (d DynamicSource) GetX509SVID() (*x509svid.SVID, error) {
 func (d DynamicSource) GetX509BundleForTrustDomain(trustDomain spiffeid.TrustDomain) (*x509bundle.Bundle, error) {
 	return GetCurrentSource().GetX509BundleForTrustDomain(trustDomain)
 }
+
+func (d DynamicSource) FetchJWTSVID(ctx context.Context, params jwtsvid.Params) (*jwtsvid.SVID, error) {
+	return GetCurrentSource().FetchJWTSVID(ctx, params)
+}
+
+func (d DynamicSource) GetJWTBundleForTrustDomain(trustDomain spiffeid.TrustDomain) (*jwtbundle.Bundle, error) {
+	return GetCurrentSource().GetJWTBundleForTrustDomain(trustDomain)
+}
+
+func (d DynamicSource) X509Bundles() []*x509bundle.Bundle {
+	return GetCurrentSource().X509Bundles()
+}
+
+func (d DynamicSource) CheckRevocation(id spiffeid.ID, verifiedChains [][]*x509.Certificate) error {
+	return GetCurrentSource().CheckRevocation(id, verifiedChains)
+}
+
+func (d DynamicSource) CheckDenied(id spiffeid.ID) error {
+	return GetCurrentSource().CheckDenied(id)
+}
+
+func (d DynamicSource) RevocationLists() []RevocationList {
+	return GetCurrentSource().RevocationLists()
+}
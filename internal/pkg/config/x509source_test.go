@@ -0,0 +1,195 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+
+	"github.com/jetstack/spiffe-demo/internal/pkg/testutil"
+	"github.com/jetstack/spiffe-demo/types"
+)
+
+func TestBundleTrustDomain(t *testing.T) {
+	ctx, dir := watchContext(t)
+	ca := testutil.NewCA(t)
+	cert, key := testutil.WriteSVID(t, dir, ca.IssueSVID(t, "spiffe://example.org/client"))
+	bundle := testutil.WriteFile(t, dir, "ca.pem", ca.CertPEM())
+
+	tests := map[string]struct {
+		trustDomain string
+		want        string
+		wantErr     string
+	}{
+		"derived from the SVID": {
+			want: "example.org",
+		},
+		"configured": {
+			trustDomain: "partner.example.com",
+			want:        "partner.example.com",
+		},
+		"invalid": {
+			trustDomain: "spiffe://Example.org",
+			wantErr:     `invalid trust domain "spiffe://Example.org"`,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			source, err := ConstructSpiffeDemoSource(ctx, func() {}, log.NewNopLogger(), &types.SpiffeConfig{
+				SVIDSources: types.SVIDSources{Files: &types.Files{
+					TrustDomain:   test.trustDomain,
+					TrustDomainCA: bundle,
+					SVIDCert:      cert,
+					SVIDKey:       key,
+				}},
+			})
+			testutil.AssertError(t, err, test.wantErr)
+			if err != nil {
+				return
+			}
+			if _, err := source.GetX509BundleForTrustDomain(spiffeid.RequireTrustDomainFromString(test.want)); err != nil {
+				t.Errorf("expected a bundle for %s, got %v", test.want, err)
+			}
+			if _, err := source.GetX509BundleForTrustDomain(spiffeid.RequireTrustDomainFromString("other.example.com")); err == nil {
+				t.Error("expected no bundle for other.example.com")
+			}
+		})
+	}
+}
+
+func TestBundleFollowsRotatedSVIDTrustDomain(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits for the SVID to be reloaded")
+	}
+	ctx, dir := watchContext(t)
+	ca := testutil.NewCA(t)
+	cert, key := testutil.WriteSVID(t, dir, ca.IssueSVID(t, "spiffe://example.org/client"))
+	source, err := ConstructSpiffeDemoSource(ctx, func() {}, log.NewNopLogger(), &types.SpiffeConfig{
+		SVIDSources: types.SVIDSources{Files: &types.Files{
+			TrustDomainCA: testutil.WriteFile(t, dir, "ca.pem", ca.CertPEM()),
+			SVIDCert:      cert,
+			SVIDKey:       key,
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.WriteSVID(t, dir, ca.IssueSVID(t, "spiffe://partner.example.com/client"))
+	partner := spiffeid.RequireTrustDomainFromString("partner.example.com")
+	// Watchers act on changes at most every 5 seconds.
+	for deadline := time.Now().Add(15 * time.Second); ; time.Sleep(100 * time.Millisecond) {
+		if _, err := source.GetX509BundleForTrustDomain(partner); err == nil {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatalf("expected the bundle to be reloaded for %s, got %v", partner, err)
+		}
+	}
+	if _, err := source.GetX509BundleForTrustDomain(spiffeid.RequireTrustDomainFromString("example.org")); err == nil {
+		t.Error("expected no bundle for the previous trust domain")
+	}
+}
+
+func TestFederatedTrustBundles(t *testing.T) {
+	ctx, dir := watchContext(t)
+	ca, partnerCA := testutil.NewCA(t), testutil.NewCA(t)
+	cert, key := testutil.WriteSVID(t, dir, ca.IssueSVID(t, "spiffe://example.org/client"))
+	bundle := testutil.WriteFile(t, dir, "ca.pem", ca.CertPEM())
+	partnerBundle := testutil.WriteFile(t, dir, "partner.pem", partnerCA.CertPEM())
+
+	tests := map[string]struct {
+		trustDomainCA string
+		federated     map[string]string
+		want          map[string]*testutil.CA
+		wantErr       string
+	}{
+		"own and federated bundles": {
+			trustDomainCA: bundle,
+			federated:     map[string]string{"partner.example.com": partnerBundle},
+			want:          map[string]*testutil.CA{"example.org": ca, "partner.example.com": partnerCA},
+		},
+		"only federated bundles": {
+			federated: map[string]string{"partner.example.com": partnerBundle},
+			want:      map[string]*testutil.CA{"partner.example.com": partnerCA},
+		},
+		"no bundles": {
+			wantErr: "no trust bundles provided in config file",
+		},
+		"invalid federated trust domain": {
+			trustDomainCA: bundle,
+			federated:     map[string]string{"Partner.example.com": partnerBundle},
+			wantErr:       `invalid federated trust domain "Partner.example.com"`,
+		},
+		"own trust domain is federated": {
+			trustDomainCA: bundle,
+			federated:     map[string]string{"example.org": partnerBundle},
+			wantErr:       `trust domain "example.org" is configured as both the trust domain and a federated trust domain`,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			source, err := ConstructSpiffeDemoSource(ctx, func() {}, log.NewNopLogger(), &types.SpiffeConfig{
+				SVIDSources: types.SVIDSources{Files: &types.Files{
+					TrustDomainCA:           test.trustDomainCA,
+					FederatedTrustDomainCAs: test.federated,
+					SVIDCert:                cert,
+					SVIDKey:                 key,
+				}},
+			})
+			testutil.AssertError(t, err, test.wantErr)
+			if err != nil {
+				return
+			}
+			for td, wantCA := range test.want {
+				bundle, err := source.GetX509BundleForTrustDomain(spiffeid.RequireTrustDomainFromString(td))
+				if err != nil {
+					t.Fatalf("expected a bundle for %s, got %v", td, err)
+				}
+				if authorities := bundle.X509Authorities(); len(authorities) != 1 || !authorities[0].Equal(wantCA.Cert) {
+					t.Errorf("expected the bundle for %s to contain its own CA", td)
+				}
+			}
+			if _, err := source.GetX509BundleForTrustDomain(spiffeid.RequireTrustDomainFromString("other.example.com")); err == nil {
+				t.Error("expected no bundle for other.example.com")
+			}
+		})
+	}
+}
+
+func TestRotatedSVIDInFederatedTrustDomain(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits for the SVID to be reloaded")
+	}
+	ctx, dir := watchContext(t)
+	ca, partnerCA := testutil.NewCA(t), testutil.NewCA(t)
+	cert, key := testutil.WriteSVID(t, dir, ca.IssueSVID(t, "spiffe://example.org/client"))
+	source, err := ConstructSpiffeDemoSource(ctx, func() {}, log.NewNopLogger(), &types.SpiffeConfig{
+		SVIDSources: types.SVIDSources{Files: &types.Files{
+			TrustDomainCA:           testutil.WriteFile(t, dir, "ca.pem", ca.CertPEM()),
+			FederatedTrustDomainCAs: map[string]string{"partner.example.com": testutil.WriteFile(t, dir, "partner.pem", partnerCA.CertPEM())},
+			SVIDCert:                cert,
+			SVIDKey:                 key,
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.WriteSVID(t, dir, ca.IssueSVID(t, "spiffe://partner.example.com/client"))
+	// Watchers act on changes at most every 5 seconds.
+	for deadline := time.Now().Add(15 * time.Second); ; time.Sleep(100 * time.Millisecond) {
+		if svid, err := source.GetX509SVID(); err == nil && svid.ID.TrustDomain().String() == "partner.example.com" {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatal("expected the SVID to be reloaded")
+		}
+	}
+	bundle, err := source.GetX509BundleForTrustDomain(spiffeid.RequireTrustDomainFromString("partner.example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if authorities := bundle.X509Authorities(); len(authorities) != 1 || !authorities[0].Equal(partnerCA.Cert) {
+		t.Error("expected our own bundle not to replace the federated bundle")
+	}
+}
@@ -0,0 +1,104 @@
+// Package identity extracts details of the peer's SVID from gRPC connections
+package identity
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"reflect"
+
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// PeerCertificate returns the leaf certificate the peer presented during the TLS handshake. It is
+// false if the peer didn't present a certificate, such as a client authenticating with a JWT-SVID.
+func PeerCertificate(p *peer.Peer) (*x509.Certificate, bool) {
+	certs := PeerCertificates(p)
+	if len(certs) == 0 {
+		return nil, false
+	}
+	return certs[0], true
+}
+
+// PeerCertificates returns the chain the peer presented during the TLS handshake, starting
+// with its leaf certificate.
+func PeerCertificates(p *peer.Peer) []*x509.Certificate {
+	if p == nil {
+		return nil
+	}
+	return Certificates(p.AuthInfo)
+}
+
+// Certificates returns the chain the peer presented during the TLS handshake which produced
+// authInfo, starting with its leaf certificate.
+func Certificates(authInfo credentials.AuthInfo) []*x509.Certificate {
+	info, ok := tlsInfo(authInfo)
+	if !ok {
+		return nil
+	}
+	return info.State.PeerCertificates
+}
+
+// PeerCertificateFromContext returns the leaf certificate presented by the peer of the call in ctx.
+func PeerCertificateFromContext(ctx context.Context) (*x509.Certificate, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	return PeerCertificate(p)
+}
+
+// PeerSerialFromContext returns the serial of the certificate presented by the peer of the call in
+// ctx, or an empty string if it didn't present one.
+func PeerSerialFromContext(ctx context.Context) string {
+	cert, ok := PeerCertificateFromContext(ctx)
+	if !ok {
+		return ""
+	}
+	return SerialString(cert)
+}
+
+// SVIDSerial returns the serial of the current X509-SVID in source, or an empty string if there is none.
+func SVIDSerial(source x509svid.Source) string {
+	svid, err := source.GetX509SVID()
+	if err != nil || len(svid.Certificates) == 0 {
+		return ""
+	}
+	return SerialString(svid.Certificates[0])
+}
+
+// SerialString formats a certificate serial number as hex, as displayed by openssl.
+func SerialString(cert *x509.Certificate) string {
+	return cert.SerialNumber.Text(16)
+}
+
+// Fingerprint returns the hex encoded SHA-256 hash of a certificate, as displayed by
+// openssl x509 -fingerprint -sha256 without the colons.
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// tlsInfo finds the credentials.TLSInfo in authInfo. The grpccredentials package wraps it in
+// an unexported type which embeds the original AuthInfo, so that embedded field is unwrapped.
+func tlsInfo(authInfo credentials.AuthInfo) (credentials.TLSInfo, bool) {
+	if info, ok := authInfo.(credentials.TLSInfo); ok {
+		return info, true
+	}
+	v := reflect.ValueOf(authInfo)
+	if v.Kind() != reflect.Struct {
+		return credentials.TLSInfo{}, false
+	}
+	embedded := v.FieldByName("AuthInfo")
+	if !embedded.IsValid() || !embedded.CanInterface() {
+		return credentials.TLSInfo{}, false
+	}
+	inner, ok := embedded.Interface().(credentials.AuthInfo)
+	if !ok || inner == nil {
+		return credentials.TLSInfo{}, false
+	}
+	return tlsInfo(inner)
+}
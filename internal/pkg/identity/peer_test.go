@@ -0,0 +1,99 @@
+package identity
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"testing"
+
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	"github.com/spiffe/go-spiffe/v2/spiffegrpc/grpccredentials"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/spiffetls/tlsconfig"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+
+	"github.com/jetstack/spiffe-demo/internal/pkg/testutil"
+)
+
+func TestPeerCertificate(t *testing.T) {
+	ca := testutil.NewCA(t)
+	cert, _ := ca.Issue(t, &x509.Certificate{})
+
+	tests := map[string]struct {
+		peer *peer.Peer
+		want *x509.Certificate
+	}{
+		"TLS": {
+			peer: &peer.Peer{AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert, ca.Cert}}}},
+			want: cert,
+		},
+		"TLS without a client certificate": {
+			peer: &peer.Peer{AuthInfo: credentials.TLSInfo{}},
+		},
+		"no auth info": {
+			peer: &peer.Peer{},
+		},
+		"no peer": {},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, ok := PeerCertificate(test.peer)
+			if ok != (test.want != nil) || got != test.want {
+				t.Errorf("expected %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+// TestPeerCertificateFromSPIFFECredentials pins the behaviour of go-spiffe's gRPC credentials,
+// whose AuthInfo wraps the TLSInfo in an unexported type that tlsInfo has to unwrap.
+func TestPeerCertificateFromSPIFFECredentials(t *testing.T) {
+	ca := testutil.NewCA(t)
+	bundle := x509bundle.FromX509Authorities(spiffeid.RequireTrustDomainFromString("example.org"), []*x509.Certificate{ca.Cert})
+	serverSVID := ca.IssueSVID(t, "spiffe://example.org/server")
+	clientSVID := ca.IssueSVID(t, "spiffe://example.org/client")
+
+	peers := make(chan *peer.Peer, 1)
+	server := grpc.NewServer(
+		grpc.Creds(grpccredentials.MTLSServerCredentials(serverSVID, bundle, tlsconfig.AuthorizeAny())),
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			p, _ := peer.FromContext(ctx)
+			peers <- p
+			return handler(ctx, req)
+		}),
+	)
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := grpc.Dial(listener.Addr().String(),
+		grpc.WithTransportCredentials(grpccredentials.MTLSClientCredentials(clientSVID, bundle, tlsconfig.AuthorizeAny())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := healthpb.NewHealthClient(conn).Check(context.Background(), new(healthpb.HealthCheckRequest)); err != nil {
+		t.Fatal(err)
+	}
+
+	p := <-peers
+	if _, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+		t.Log("go-spiffe no longer wraps the TLSInfo, tlsInfo no longer needs to unwrap it")
+	}
+	if id, ok := grpccredentials.PeerIDFromPeer(p); !ok || id != clientSVID.ID {
+		t.Errorf("expected go-spiffe to report the peer ID %s, got %s", clientSVID.ID, id)
+	}
+	cert, ok := PeerCertificate(p)
+	if !ok || !cert.Equal(clientSVID.Certificates[0]) {
+		t.Errorf("expected the client's certificate, got %v", cert)
+	}
+}
@@ -0,0 +1,46 @@
+// Package logging builds the structured, levelled loggers used by the SPIFFE demo server and client
+package logging
+
+import (
+	"fmt"
+	"io"
+	stdlog "log"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+// Supported log formats
+const (
+	FormatLogfmt = "logfmt"
+	FormatJSON   = "json"
+)
+
+// New returns a logger writing to w in format, which is FormatLogfmt or FormatJSON, dropping
+// messages below lvl, which is one of debug, info, warn or error. Every message is timestamped
+// and records where it was logged from.
+func New(w io.Writer, format, lvl string) (log.Logger, error) {
+	var logger log.Logger
+	switch format {
+	case FormatLogfmt, "":
+		logger = log.NewLogfmtLogger(log.NewSyncWriter(w))
+	case FormatJSON:
+		logger = log.NewJSONLogger(log.NewSyncWriter(w))
+	default:
+		return nil, fmt.Errorf("unknown log format %q, must be %q or %q", format, FormatLogfmt, FormatJSON)
+	}
+
+	allowed, err := level.Parse(lvl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid log level %q, must be debug, info, warn or error", lvl)
+	}
+	logger = level.NewFilter(logger, level.Allow(allowed))
+	return log.With(logger, "ts", log.DefaultTimestampUTC, "caller", log.DefaultCaller), nil
+}
+
+// RedirectStdlib sends anything logged with the standard library's global logger, such as by
+// dependencies, to logger at info level.
+func RedirectStdlib(logger log.Logger) {
+	stdlog.SetFlags(0)
+	stdlog.SetOutput(log.NewStdlibAdapter(level.Info(logger)))
+}
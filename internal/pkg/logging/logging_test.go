@@ -0,0 +1,116 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	stdlog "log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log/level"
+
+	"github.com/jetstack/spiffe-demo/internal/pkg/testutil"
+)
+
+func TestNew(t *testing.T) {
+	tests := map[string]struct {
+		format string
+		level  string
+		want   []string
+	}{
+		"logfmt": {
+			format: FormatLogfmt,
+			level:  "info",
+			want:   []string{`level=info`, `caller=logging_test.go:`, `msg="info message"`, `level=warn`, `msg="warn message"`},
+		},
+		"default format": {
+			level: "info",
+			want:  []string{`level=info`, `msg="info message"`},
+		},
+		"debug level": {
+			format: FormatLogfmt,
+			level:  "debug",
+			want:   []string{`msg="debug message"`, `msg="info message"`},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger, err := New(&buf, test.format, test.level)
+			if err != nil {
+				t.Fatal(err)
+			}
+			level.Debug(logger).Log("msg", "debug message")
+			level.Info(logger).Log("msg", "info message")
+			level.Warn(logger).Log("msg", "warn message")
+
+			for _, want := range test.want {
+				if !strings.Contains(buf.String(), want) {
+					t.Errorf("expected the log to contain %s, got %q", want, buf.String())
+				}
+			}
+			if test.level != "debug" && strings.Contains(buf.String(), "debug message") {
+				t.Errorf("expected debug messages to be dropped at level %s, got %q", test.level, buf.String())
+			}
+		})
+	}
+}
+
+func TestNewJSON(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, FormatJSON, "warn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	level.Info(logger).Log("msg", "dropped")
+	level.Error(logger).Log("msg", "failed", "file", "config.yaml")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("expected a single JSON entry, got %q: %v", buf.String(), err)
+	}
+	for key, want := range map[string]string{"level": "error", "msg": "failed", "file": "config.yaml"} {
+		if entry[key] != want {
+			t.Errorf("expected %s to be %q, got %v", key, want, entry[key])
+		}
+	}
+	if _, ok := entry["ts"]; !ok {
+		t.Error("expected a timestamp")
+	}
+}
+
+func TestNewRejectsInvalidOptions(t *testing.T) {
+	tests := map[string]struct {
+		format  string
+		level   string
+		wantErr string
+	}{
+		"unknown format": {format: "text", level: "info", wantErr: `unknown log format "text"`},
+		"unknown level":  {format: FormatLogfmt, level: "verbose", wantErr: `invalid log level "verbose"`},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := New(new(bytes.Buffer), test.format, test.level)
+			testutil.AssertError(t, err, test.wantErr)
+		})
+	}
+}
+
+func TestRedirectStdlib(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, FormatLogfmt, "info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	RedirectStdlib(logger)
+	t.Cleanup(func() {
+		stdlog.SetFlags(stdlog.LstdFlags)
+		stdlog.SetOutput(os.Stderr)
+	})
+
+	stdlog.Println("from a dependency")
+	if got := buf.String(); !strings.Contains(got, `level=info`) || !strings.Contains(got, `msg="from a dependency"`) {
+		t.Errorf("expected the standard library's log to be logged at info level, got %q", got)
+	}
+}
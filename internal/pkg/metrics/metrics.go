@@ -0,0 +1,83 @@
+// Package metrics exposes Prometheus metrics for the SPIFFE demo server and client
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+
+	"github.com/jetstack/spiffe-demo/internal/pkg/config"
+)
+
+const namespace = "spiffe_demo"
+
+// Registry holds all metrics served by Serve.
+var Registry = prometheus.NewRegistry()
+
+var reloadsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "reloads_total",
+	Help:      "Number of times a watched file was reloaded, by file and result (success or failure).",
+}, []string{"file", "result"})
+
+var denialsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "deny_list_denials_total",
+	Help:      "Number of times a peer was rejected because of a deny list entry, by entry and the peer's trust domain.",
+}, []string{"entry", "peer_trust_domain"})
+
+// Register registers the process, reload, deny list and SVID metrics in Registry and starts counting
+// reloads and denials. It must only be called once, before Serve.
+func Register() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		reloadsTotal,
+		denialsTotal,
+		newSVIDCollector(config.CurrentSource),
+	)
+	config.SetReloadObserver(func(path string, err error) {
+		result := "success"
+		if err != nil {
+			result = "failure"
+		}
+		reloadsTotal.WithLabelValues(path, result).Inc()
+	})
+	config.SetDenyObserver(func(entry string, id spiffeid.ID) {
+		denialsTotal.WithLabelValues(entry, id.TrustDomain().String()).Inc()
+	})
+}
+
+// Serve serves the metrics in Registry over HTTP at /metrics until ctx is cancelled.
+func Serve(ctx context.Context, logger log.Logger, address string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry}))
+	server := &http.Server{
+		Addr:              address,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			level.Error(logger).Log("msg", "error shutting down metrics server", "error", err)
+		}
+	}()
+
+	level.Info(logger).Log("msg", "serving metrics", "address", address)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+)
+
+// RateLimitBucket is the state of one caller's token bucket for a rate limit.
+type RateLimitBucket struct {
+	Limit  string
+	PeerID spiffeid.ID
+	// Tokens is how many calls the caller could make straight away
+	Tokens float64
+}
+
+// rateLimitState is implemented by the server
+type rateLimitState interface {
+	RateLimitBuckets() []RateLimitBucket
+}
+
+// RateLimitMetrics counts calls rejected by the server's rate limits, and reports on its token
+// buckets every time it is scraped.
+type RateLimitMetrics struct {
+	peerIDLabel bool
+	state       rateLimitState
+
+	limited *prometheus.CounterVec
+	callers *prometheus.Desc
+	tokens  *prometheus.Desc
+}
+
+// NewRateLimitMetrics creates rate limit metrics reporting on the buckets in state, and registers
+// them in Registry. The tokens left in each caller's bucket are only reported if peerIDLabel is
+// set, as that gives a series per caller.
+func NewRateLimitMetrics(peerIDLabel bool, state rateLimitState) *RateLimitMetrics {
+	labels := []string{"limit", "method", "peer_trust_domain"}
+	if peerIDLabel {
+		labels = append(labels, "peer_id")
+	}
+	m := &RateLimitMetrics{
+		peerIDLabel: peerIDLabel,
+		state:       state,
+		limited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "server",
+			Name:      "rate_limited_rpcs_total",
+			Help:      "Number of RPCs rejected because the caller exceeded a rate limit.",
+		}, labels),
+		callers: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "server", "rate_limit_callers"),
+			"Number of callers with a token bucket for a rate limit. Buckets are dropped once they have refilled.",
+			[]string{"limit"}, nil,
+		),
+		tokens: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "server", "rate_limit_tokens"),
+			"Number of calls a caller could make straight away without exceeding a rate limit.",
+			[]string{"limit", "peer_id"}, nil,
+		),
+	}
+	Registry.MustRegister(m.limited, m)
+	return m
+}
+
+// Limited records a call rejected by a rate limit.
+func (m *RateLimitMetrics) Limited(limit, method string, peerID spiffeid.ID) {
+	if m == nil {
+		return
+	}
+	labels := []string{limit, method, peerID.TrustDomain().String()}
+	if m.peerIDLabel {
+		labels = append(labels, peerID.String())
+	}
+	m.limited.WithLabelValues(labels...).Inc()
+}
+
+func (m *RateLimitMetrics) Describe(ch chan<- *prometheus.Desc) {
+	ch <- m.callers
+	if m.peerIDLabel {
+		ch <- m.tokens
+	}
+}
+
+func (m *RateLimitMetrics) Collect(ch chan<- prometheus.Metric) {
+	callers := make(map[string]int)
+	for _, bucket := range m.state.RateLimitBuckets() {
+		callers[bucket.Limit]++
+		if m.peerIDLabel {
+			ch <- prometheus.MustNewConstMetric(m.tokens, prometheus.GaugeValue, bucket.Tokens, bucket.Limit, bucket.PeerID.String())
+		}
+	}
+	for limit, n := range callers {
+		ch <- prometheus.MustNewConstMetric(m.callers, prometheus.GaugeValue, float64(n), limit)
+	}
+}
@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"google.golang.org/grpc/codes"
+)
+
+// RPCMetrics counts and times RPCs, labelled by method, status code and the trust domain
+// of the peer, and optionally the peer's full SPIFFE ID.
+type RPCMetrics struct {
+	peerIDLabel bool
+
+	total    *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+// NewRPCMetrics creates RPC metrics for one side of the connection, either "server" or "client",
+// and registers them in Registry. Labelling by peer ID gives a series per caller, so it should
+// only be enabled when the number of peers is small.
+func NewRPCMetrics(side string, peerIDLabel bool) *RPCMetrics {
+	labels := []string{"method", "code", "peer_trust_domain"}
+	if peerIDLabel {
+		labels = append(labels, "peer_id")
+	}
+	m := &RPCMetrics{
+		peerIDLabel: peerIDLabel,
+		total: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: side,
+			Name:      "rpcs_total",
+			Help:      "Number of completed RPCs.",
+		}, labels),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: side,
+			Name:      "rpc_duration_seconds",
+			Help:      "Duration of completed RPCs.",
+			Buckets:   prometheus.DefBuckets,
+		}, labels),
+	}
+	Registry.MustRegister(m.total, m.duration)
+	return m
+}
+
+// Observe records a completed RPC. peerID is the zero ID if the peer is unknown, for example
+// because it failed to authenticate.
+func (m *RPCMetrics) Observe(method string, code codes.Code, peerID spiffeid.ID, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	labels := []string{method, code.String(), peerID.TrustDomain().String()}
+	if m.peerIDLabel {
+		labels = append(labels, peerID.String())
+	}
+	m.total.WithLabelValues(labels...).Inc()
+	m.duration.WithLabelValues(labels...).Observe(duration.Seconds())
+}
@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
+
+	"github.com/jetstack/spiffe-demo/internal/pkg/config"
+)
+
+// svidSource is implemented by config.DynamicSource
+type svidSource interface {
+	x509svid.Source
+	X509Bundles() []*x509bundle.Bundle
+	RevocationLists() []config.RevocationList
+}
+
+// svidCollector reports on the current SVID, trust bundles and CRLs every time it is scraped,
+// so that the values are always up to date after a rotation.
+type svidCollector struct {
+	source svidSource
+
+	notAfter      *prometheus.Desc
+	remaining     *prometheus.Desc
+	authorities   *prometheus.Desc
+	crlNextUpdate *prometheus.Desc
+	crlRevoked    *prometheus.Desc
+}
+
+func newSVIDCollector(source svidSource) *svidCollector {
+	return &svidCollector{
+		source: source,
+		notAfter: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "svid", "not_after_timestamp_seconds"),
+			"Time after which the current X509-SVID is no longer valid, in seconds since the epoch.",
+			[]string{"spiffe_id"}, nil,
+		),
+		remaining: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "svid", "remaining_seconds"),
+			"Seconds until the current X509-SVID expires, negative if it has expired.",
+			[]string{"spiffe_id"}, nil,
+		),
+		authorities: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "trust_bundle", "authorities"),
+			"Number of CA certificates in the trust bundle for a trust domain.",
+			[]string{"trust_domain"}, nil,
+		),
+		crlNextUpdate: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "crl", "next_update_timestamp_seconds"),
+			"Time by which a newer CRL should have been published, in seconds since the epoch. A CRL is stale once this has passed. Not reported for CRLs without a next update time.",
+			[]string{"trust_domain", "file"}, nil,
+		),
+		crlRevoked: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "crl", "revoked_certificates"),
+			"Number of revoked certificates listed in a CRL file.",
+			[]string{"trust_domain", "file"}, nil,
+		),
+	}
+}
+
+func (c *svidCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.notAfter
+	ch <- c.remaining
+	ch <- c.authorities
+	ch <- c.crlNextUpdate
+	ch <- c.crlRevoked
+}
+
+func (c *svidCollector) Collect(ch chan<- prometheus.Metric) {
+	if svid, err := c.source.GetX509SVID(); err == nil && len(svid.Certificates) > 0 {
+		notAfter := svid.Certificates[0].NotAfter
+		ch <- prometheus.MustNewConstMetric(c.notAfter, prometheus.GaugeValue, float64(notAfter.Unix()), svid.ID.String())
+		ch <- prometheus.MustNewConstMetric(c.remaining, prometheus.GaugeValue, time.Until(notAfter).Seconds(), svid.ID.String())
+	}
+	for _, bundle := range c.source.X509Bundles() {
+		ch <- prometheus.MustNewConstMetric(c.authorities, prometheus.GaugeValue, float64(len(bundle.X509Authorities())), bundle.TrustDomain().String())
+	}
+	for _, crl := range c.source.RevocationLists() {
+		if !crl.NextUpdate.IsZero() {
+			ch <- prometheus.MustNewConstMetric(c.crlNextUpdate, prometheus.GaugeValue, float64(crl.NextUpdate.Unix()), crl.TrustDomain.String(), crl.Path)
+		}
+		ch <- prometheus.MustNewConstMetric(c.crlRevoked, prometheus.GaugeValue, float64(crl.Revoked), crl.TrustDomain.String(), crl.Path)
+	}
+}
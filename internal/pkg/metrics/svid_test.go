@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"crypto/x509"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
+
+	"github.com/jetstack/spiffe-demo/internal/pkg/config"
+	spiffetestutil "github.com/jetstack/spiffe-demo/internal/pkg/testutil"
+)
+
+type fakeSource struct {
+	svid    *x509svid.SVID
+	bundles []*x509bundle.Bundle
+	crls    []config.RevocationList
+}
+
+func (f fakeSource) GetX509SVID() (*x509svid.SVID, error) { return f.svid, nil }
+
+func (f fakeSource) X509Bundles() []*x509bundle.Bundle { return f.bundles }
+
+func (f fakeSource) RevocationLists() []config.RevocationList { return f.crls }
+
+func TestSVIDCollector(t *testing.T) {
+	ca := spiffetestutil.NewCA(t)
+	svid := ca.IssueSVID(t, "spiffe://example.org/server")
+	bundles := []*x509bundle.Bundle{
+		x509bundle.FromX509Authorities(spiffeid.RequireTrustDomainFromString("example.org"), []*x509.Certificate{ca.Cert}),
+		x509bundle.FromX509Authorities(spiffeid.RequireTrustDomainFromString("partner.example.com"), []*x509.Certificate{ca.Cert, ca.Cert}),
+	}
+
+	collector := newSVIDCollector(fakeSource{svid: svid, bundles: bundles})
+	want := fmt.Sprintf(`
+# HELP spiffe_demo_svid_not_after_timestamp_seconds Time after which the current X509-SVID is no longer valid, in seconds since the epoch.
+# TYPE spiffe_demo_svid_not_after_timestamp_seconds gauge
+spiffe_demo_svid_not_after_timestamp_seconds{spiffe_id="spiffe://example.org/server"} %d
+# HELP spiffe_demo_trust_bundle_authorities Number of CA certificates in the trust bundle for a trust domain.
+# TYPE spiffe_demo_trust_bundle_authorities gauge
+spiffe_demo_trust_bundle_authorities{trust_domain="example.org"} 1
+spiffe_demo_trust_bundle_authorities{trust_domain="partner.example.com"} 2
+`, svid.Certificates[0].NotAfter.Unix())
+	err := testutil.CollectAndCompare(collector, strings.NewReader(want),
+		"spiffe_demo_svid_not_after_timestamp_seconds", "spiffe_demo_trust_bundle_authorities")
+	if err != nil {
+		t.Error(err)
+	}
+	if n := testutil.CollectAndCount(collector, "spiffe_demo_svid_remaining_seconds"); n != 1 {
+		t.Errorf("expected 1 remaining_seconds series, got %d", n)
+	}
+
+	if n := testutil.CollectAndCount(newSVIDCollector(fakeSource{svid: new(x509svid.SVID)}), "spiffe_demo_svid_not_after_timestamp_seconds"); n != 0 {
+		t.Errorf("expected no series without an SVID, got %d", n)
+	}
+}
+
+func TestSVIDCollectorCRLs(t *testing.T) {
+	td := spiffeid.RequireTrustDomainFromString("example.org")
+	nextUpdate := time.Now().Add(time.Hour).Truncate(time.Second)
+	collector := newSVIDCollector(fakeSource{svid: new(x509svid.SVID), crls: []config.RevocationList{
+		{TrustDomain: td, Path: "/crl/ca.crl", NextUpdate: nextUpdate, Revoked: 2},
+		{TrustDomain: td, Path: "/crl/no-next-update.crl", Revoked: 1},
+	}})
+	want := fmt.Sprintf(`
+# HELP spiffe_demo_crl_next_update_timestamp_seconds Time by which a newer CRL should have been published, in seconds since the epoch. A CRL is stale once this has passed. Not reported for CRLs without a next update time.
+# TYPE spiffe_demo_crl_next_update_timestamp_seconds gauge
+spiffe_demo_crl_next_update_timestamp_seconds{file="/crl/ca.crl",trust_domain="example.org"} %d
+# HELP spiffe_demo_crl_revoked_certificates Number of revoked certificates listed in a CRL file.
+# TYPE spiffe_demo_crl_revoked_certificates gauge
+spiffe_demo_crl_revoked_certificates{file="/crl/ca.crl",trust_domain="example.org"} 2
+spiffe_demo_crl_revoked_certificates{file="/crl/no-next-update.crl",trust_domain="example.org"} 1
+`, nextUpdate.Unix())
+	err := testutil.CollectAndCompare(collector, strings.NewReader(want),
+		"spiffe_demo_crl_next_update_timestamp_seconds", "spiffe_demo_crl_revoked_certificates")
+	if err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,169 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"gopkg.in/natefinch/lumberjack.v2"
+
+	"github.com/jetstack/spiffe-demo/internal/pkg/identity"
+	"github.com/jetstack/spiffe-demo/types"
+)
+
+// DefaultAuditMaxSizeMB is the size audit log files are rotated at, unless configured otherwise.
+const DefaultAuditMaxSizeMB = 100
+
+// Audit events
+const (
+	auditEventCall            = "call"
+	auditEventHandshakeFailed = "handshake_failed"
+)
+
+// auditEntry is a single line of the audit log
+type auditEntry struct {
+	Time  time.Time `json:"time"`
+	Event string    `json:"event"`
+
+	PeerID                 string `json:"peer_id,omitempty"`
+	CertificateSerial      string `json:"certificate_serial,omitempty"`
+	CertificateFingerprint string `json:"certificate_fingerprint,omitempty"`
+	RemoteAddress          string `json:"remote_address,omitempty"`
+
+	Method string `json:"method,omitempty"`
+	// Allowed is only set for calls which reached the authorization policy
+	Allowed *bool  `json:"allowed,omitempty"`
+	Rule    string `json:"rule,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// OpenAuditLog opens the audit log described by cfg, which is rotated once it reaches its
+// maximum size. A path of "-" writes to stdout, which is never closed or rotated.
+func OpenAuditLog(cfg *types.AuditConfig) (io.WriteCloser, error) {
+	if cfg == nil || len(cfg.Path) == 0 {
+		return nil, errors.New("no audit log path configured")
+	}
+	if cfg.Path == "-" {
+		return nopCloser{os.Stdout}, nil
+	}
+	maxSize := cfg.MaxSizeMB
+	if maxSize <= 0 {
+		maxSize = DefaultAuditMaxSizeMB
+	}
+	return &lumberjack.Logger{
+		Filename:   cfg.Path,
+		MaxSize:    maxSize,
+		MaxBackups: cfg.MaxBackups,
+	}, nil
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// auditor writes audit entries to the server's AuditLog, one JSON object per line.
+type auditor struct {
+	s  *Server
+	mu sync.Mutex
+}
+
+func (a *auditor) write(entry auditEntry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		level.Error(a.s.logger()).Log("msg", "failed to encode audit entry", "error", err)
+		return
+	}
+	line = append(line, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.s.AuditLog.Write(line); err != nil {
+		level.Error(a.s.logger()).Log("msg", "failed to write audit entry", "error", err)
+	}
+}
+
+// recordCall writes an entry for a finished call, using what the other interceptors recorded in info.
+func (a *auditor) recordCall(ctx context.Context, info *callInfo, err error) {
+	entry := auditEntry{
+		Time:   info.start.UTC(),
+		Event:  auditEventCall,
+		Method: info.method,
+		Code:   status.Code(err).String(),
+	}
+	if !info.peerID.IsZero() {
+		entry.PeerID = info.peerID.String()
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		if p.Addr != nil {
+			entry.RemoteAddress = p.Addr.String()
+		}
+		if cert, ok := identity.PeerCertificate(p); ok {
+			entry.CertificateSerial = identity.SerialString(cert)
+			entry.CertificateFingerprint = identity.Fingerprint(cert)
+		}
+	}
+	if info.decision != nil {
+		allowed := info.decision.Allowed
+		entry.Allowed = &allowed
+		entry.Rule = info.decision.Rule
+	}
+	if err != nil {
+		entry.Error = status.Convert(err).Message()
+	}
+	a.write(entry)
+}
+
+func (a *auditor) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	resp, err := handler(ctx, req)
+	if call := callInfoFromContext(ctx); call != nil {
+		a.recordCall(ctx, call, err)
+	}
+	return resp, err
+}
+
+func (a *auditor) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	err := handler(srv, ss)
+	if call := callInfoFromContext(ss.Context()); call != nil {
+		a.recordCall(ss.Context(), call, err)
+	}
+	return err
+}
+
+// auditCredentials records failed TLS handshakes, such as clients presenting an SVID that
+// doesn't chain to a trusted CA, which never reach the interceptors.
+type auditCredentials struct {
+	credentials.TransportCredentials
+	auditor *auditor
+}
+
+func (c auditCredentials) ServerHandshake(rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	conn, authInfo, err := c.TransportCredentials.ServerHandshake(rawConn)
+	if err != nil {
+		c.auditor.write(auditEntry{
+			Time:          time.Now().UTC(),
+			Event:         auditEventHandshakeFailed,
+			RemoteAddress: rawConn.RemoteAddr().String(),
+			Error:         err.Error(),
+		})
+	}
+	return conn, authInfo, err
+}
+
+func (c auditCredentials) Clone() credentials.TransportCredentials {
+	return auditCredentials{TransportCredentials: c.TransportCredentials.Clone(), auditor: c.auditor}
+}
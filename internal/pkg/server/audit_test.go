@@ -0,0 +1,166 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/jetstack/spiffe-demo/internal/pkg/identity"
+	"github.com/jetstack/spiffe-demo/internal/pkg/testutil"
+	"github.com/jetstack/spiffe-demo/types"
+)
+
+func TestAuditCall(t *testing.T) {
+	ca := testutil.NewCA(t)
+	cert, _ := ca.Issue(t, &x509.Certificate{})
+	start := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+	ctx := peer.NewContext(context.Background(), &peer.Peer{
+		Addr:     &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 4321},
+		AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}},
+	})
+
+	tests := map[string]struct {
+		decision *Decision
+		err      error
+		want     map[string]interface{}
+	}{
+		"allowed": {
+			decision: &Decision{Allowed: true, Rule: "default[0]"},
+			want: map[string]interface{}{
+				"allowed": true,
+				"rule":    "default[0]",
+				"code":    "OK",
+			},
+		},
+		"denied": {
+			decision: &Decision{Allowed: false, Rule: "no matching rule"},
+			err:      status.Error(codes.PermissionDenied, "not allowed"),
+			want: map[string]interface{}{
+				"allowed": false,
+				"rule":    "no matching rule",
+				"code":    "PermissionDenied",
+				"error":   "not allowed",
+			},
+		},
+		"failed before authorization": {
+			err: status.Error(codes.Unauthenticated, "no SVID provided"),
+			want: map[string]interface{}{
+				"code":  "Unauthenticated",
+				"error": "no SVID provided",
+			},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			a := &auditor{s: &Server{AuditLog: &buf}}
+			a.recordCall(ctx, &callInfo{
+				method:   "/SpiffeDemo/HelloWorld",
+				start:    start,
+				peerID:   spiffeid.RequireFromString("spiffe://example.org/client"),
+				decision: test.decision,
+			}, test.err)
+
+			want := map[string]interface{}{
+				"time":                    "2022-05-01T12:00:00Z",
+				"event":                   "call",
+				"peer_id":                 "spiffe://example.org/client",
+				"certificate_serial":      identity.SerialString(cert),
+				"certificate_fingerprint": identity.Fingerprint(cert),
+				"remote_address":          "10.0.0.1:4321",
+				"method":                  "/SpiffeDemo/HelloWorld",
+			}
+			for key, value := range test.want {
+				want[key] = value
+			}
+			assertAuditLine(t, buf.String(), want)
+		})
+	}
+}
+
+type failingCredentials struct {
+	credentials.TransportCredentials
+}
+
+func (failingCredentials) ServerHandshake(net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return nil, nil, errors.New("x509: certificate signed by unknown authority")
+}
+
+func TestAuditFailedHandshake(t *testing.T) {
+	var buf bytes.Buffer
+	creds := auditCredentials{TransportCredentials: failingCredentials{}, auditor: &auditor{s: &Server{AuditLog: &buf}}}
+	server, client := net.Pipe()
+	defer client.Close()
+	if _, _, err := creds.ServerHandshake(server); err == nil {
+		t.Fatal("expected the handshake to fail")
+	}
+
+	// the time of a failed handshake can't be controlled, so it is only checked for presence
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := entry["time"]; !ok {
+		t.Errorf("expected a time, got %s", buf.String())
+	}
+	delete(entry, "time")
+	want := map[string]interface{}{
+		"event":          "handshake_failed",
+		"remote_address": "pipe",
+		"error":          "x509: certificate signed by unknown authority",
+	}
+	if mustMarshal(t, entry) != mustMarshal(t, want) {
+		t.Errorf("expected %s, got %s", mustMarshal(t, want), buf.String())
+	}
+}
+
+func TestOpenAuditLog(t *testing.T) {
+	_, err := OpenAuditLog(&types.AuditConfig{})
+	testutil.AssertError(t, err, "no audit log path configured")
+
+	stdout, err := OpenAuditLog(&types.AuditConfig{Path: "-"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stdout.Close(); err != nil {
+		t.Errorf("expected closing stdout to be a no-op, got %v", err)
+	}
+}
+
+// assertAuditLine checks that line is a single JSON object followed by a newline, with exactly
+// the fields in want.
+func assertAuditLine(t *testing.T, line string, want map[string]interface{}) {
+	t.Helper()
+	if strings.Count(line, "\n") != 1 || !strings.HasSuffix(line, "\n") {
+		t.Fatalf("expected a single line, got %q", line)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &got); err != nil {
+		t.Fatal(err)
+	}
+	if mustMarshal(t, got) != mustMarshal(t, want) {
+		t.Errorf("expected %s, got %s", mustMarshal(t, want), mustMarshal(t, got))
+	}
+}
+
+func mustMarshal(t *testing.T, v interface{}) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
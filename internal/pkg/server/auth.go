@@ -0,0 +1,95 @@
+package server
+
+import (
+	"context"
+	"strings"
+
+	"github.com/spiffe/go-spiffe/v2/bundle/jwtbundle"
+	"github.com/spiffe/go-spiffe/v2/spiffegrpc/grpccredentials"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/svid/jwtsvid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type peerIDKey struct{}
+
+// PeerIDFromContext returns the SPIFFE ID of the caller, regardless of whether it was
+// authenticated with an X509-SVID during the mTLS handshake or with a JWT-SVID bearer token.
+func PeerIDFromContext(ctx context.Context) (spiffeid.ID, bool) {
+	if id, ok := ctx.Value(peerIDKey{}).(spiffeid.ID); ok {
+		return id, true
+	}
+	return grpccredentials.PeerIDFromContext(ctx)
+}
+
+// jwtAuthenticator validates JWT-SVID bearer tokens sent in the authorization metadata.
+type jwtAuthenticator struct {
+	bundles jwtbundle.Source
+	// audiences returns the accepted audiences, it is called for every request
+	// so that they can change without restarting the server.
+	audiences func() ([]string, error)
+	// denied returns an error if a caller is on the deny list, if set.
+	denied func(spiffeid.ID) error
+}
+
+// authenticate validates the bearer token in the incoming metadata and returns a context carrying
+// the SPIFFE ID of the token's subject.
+func (a *jwtAuthenticator) authenticate(ctx context.Context) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "no JWT-SVID provided")
+	}
+	token := strings.TrimSpace(values[0])
+	if len(token) < len("bearer ") || !strings.EqualFold(token[:len("bearer ")], "bearer ") {
+		return nil, status.Error(codes.Unauthenticated, "authorization metadata is not a bearer token")
+	}
+
+	audiences, err := a.audiences()
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "could not determine JWT-SVID audience: %s", err)
+	}
+	svid, err := jwtsvid.ParseAndValidate(strings.TrimSpace(token[len("bearer "):]), a.bundles, audiences)
+	if err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, "invalid JWT-SVID: %s", err)
+	}
+	// Callers presenting an X509-SVID are checked against the deny list in the TLS handshake instead.
+	if a.denied != nil {
+		if err := a.denied(svid.ID); err != nil {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+	}
+	if info := callInfoFromContext(ctx); info != nil {
+		info.peerID = svid.ID
+	}
+	return context.WithValue(ctx, peerIDKey{}, svid.ID), nil
+}
+
+func (a *jwtAuthenticator) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := a.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (a *jwtAuthenticator) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := a.authenticate(ss.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &wrappedStream{ServerStream: ss, ctx: ctx})
+}
+
+// wrappedStream overrides the context of a grpc.ServerStream.
+type wrappedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (w *wrappedStream) Context() context.Context {
+	return w.ctx
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/bundle/jwtbundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/jetstack/spiffe-demo/internal/pkg/testutil"
+)
+
+func TestJWTAuthenticator(t *testing.T) {
+	trustDomain := spiffeid.RequireTrustDomainFromString("example.org")
+	authority, rogue := testutil.NewJWTAuthority(t, "key-1"), testutil.NewJWTAuthority(t, "key-1")
+	bundle := jwtbundle.New(trustDomain)
+	bundle.AddJWTAuthority(authority.KeyID, authority.Key.Public())
+
+	id := "spiffe://example.org/client"
+	valid := authority.Sign(t, id, []string{"server"}, time.Now().Add(time.Hour))
+
+	tests := map[string]struct {
+		authorization []string
+		audiencesErr  error
+		deniedErr     error
+		wantCode      codes.Code
+		wantErr       string
+	}{
+		"valid": {
+			authorization: []string{"Bearer " + valid},
+		},
+		"lower case scheme": {
+			authorization: []string{"bearer " + valid},
+		},
+		"no token": {
+			wantCode: codes.Unauthenticated,
+			wantErr:  "no JWT-SVID provided",
+		},
+		"not a bearer token": {
+			authorization: []string{"Basic dXNlcjpwYXNz"},
+			wantCode:      codes.Unauthenticated,
+			wantErr:       "authorization metadata is not a bearer token",
+		},
+		"wrong audience": {
+			authorization: []string{"Bearer " + authority.Sign(t, id, []string{"other"}, time.Now().Add(time.Hour))},
+			wantCode:      codes.Unauthenticated,
+			wantErr:       "invalid JWT-SVID",
+		},
+		"untrusted signer": {
+			authorization: []string{"Bearer " + rogue.Sign(t, id, []string{"server"}, time.Now().Add(time.Hour))},
+			wantCode:      codes.Unauthenticated,
+			wantErr:       "invalid JWT-SVID",
+		},
+		"audiences unavailable": {
+			authorization: []string{"Bearer " + valid},
+			audiencesErr:  errors.New("no config"),
+			wantCode:      codes.Unavailable,
+			wantErr:       "could not determine JWT-SVID audience: no config",
+		},
+		"denied": {
+			authorization: []string{"Bearer " + valid},
+			deniedErr:     errors.New("spiffe://example.org/client is on the deny list (/client)"),
+			wantCode:      codes.PermissionDenied,
+			wantErr:       "spiffe://example.org/client is on the deny list (/client)",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			authenticator := &jwtAuthenticator{
+				bundles: bundle,
+				audiences: func() ([]string, error) {
+					return []string{"server"}, test.audiencesErr
+				},
+				denied: func(spiffeid.ID) error {
+					return test.deniedErr
+				},
+			}
+			ctx := context.Background()
+			if test.authorization != nil {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", test.authorization[0]))
+			}
+
+			ctx, err := authenticator.authenticate(ctx)
+			testutil.AssertError(t, err, test.wantErr)
+			if code := status.Code(err); code != test.wantCode {
+				t.Errorf("expected code %s, got %s", test.wantCode, code)
+			}
+			if err != nil {
+				return
+			}
+			if peerID, ok := PeerIDFromContext(ctx); !ok || peerID.String() != id {
+				t.Errorf("expected peer ID %s, got %s", id, peerID)
+			}
+		})
+	}
+}
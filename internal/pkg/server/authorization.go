@@ -0,0 +1,288 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/jetstack/spiffe-demo/internal/pkg/config"
+	"github.com/jetstack/spiffe-demo/types"
+)
+
+// Decision is the outcome of authorizing a call, along with the rule that led to it.
+type Decision struct {
+	Allowed bool
+	// Rule identifies the rule that allowed the call, or why it was denied.
+	Rule string
+}
+
+// AuthorizationRequest describes a call to be authorized.
+type AuthorizationRequest struct {
+	// PeerID is the SPIFFE ID of the caller
+	PeerID spiffeid.ID
+	// ServerID is the SPIFFE ID of the server's own SVID
+	ServerID spiffeid.ID
+	// Method is the full gRPC method name
+	Method string
+}
+
+// Authorizer enforces an AuthorizationPolicy. The policy is validated once when the
+// Authorizer is constructed, so that a bad policy is rejected before it is used.
+type Authorizer struct {
+	// allowAll is set when no policy is configured
+	allowAll bool
+	logger   log.Logger
+
+	defaultRules []rule
+	methodRules  map[string][]rule
+}
+
+// rule is a validated types.AuthorizationRule
+type rule struct {
+	name string
+
+	ids          []spiffeid.ID
+	trustDomains []spiffeid.TrustDomain
+	pathPrefixes []string
+	patterns     []string
+	expression   *expression
+}
+
+// NewAuthorizer validates policy and returns an Authorizer enforcing it. A nil policy allows
+// any caller to call any method. Expressions that fail to evaluate are logged to logger.
+func NewAuthorizer(policy *types.AuthorizationPolicy, logger log.Logger) (*Authorizer, error) {
+	if policy == nil {
+		return &Authorizer{allowAll: true, logger: logger}, nil
+	}
+
+	a := &Authorizer{
+		logger:      logger,
+		methodRules: make(map[string][]rule, len(policy.Methods)),
+	}
+	var err error
+	a.defaultRules, err = newRules("default", policy.Default)
+	if err != nil {
+		return nil, err
+	}
+	for method, rules := range policy.Methods {
+		if !strings.HasPrefix(method, "/") || strings.Count(method, "/") != 2 {
+			return nil, fmt.Errorf("policy method %q is not a full gRPC method name such as /SpiffeDemo/HelloWorld", method)
+		}
+		a.methodRules[method], err = newRules(fmt.Sprintf("methods[%s]", method), rules)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+func newRules(name string, rules []types.AuthorizationRule) ([]rule, error) {
+	var parsed []rule
+	for i, r := range rules {
+		p := rule{
+			name:         fmt.Sprintf("%s[%d]", name, i),
+			pathPrefixes: r.PathPrefixes,
+			patterns:     r.Patterns,
+		}
+		for _, id := range r.IDs {
+			spiffeID, err := spiffeid.FromString(id)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid SPIFFE ID %q: %w", p.name, id, err)
+			}
+			p.ids = append(p.ids, spiffeID)
+		}
+		for _, td := range r.TrustDomains {
+			trustDomain, err := spiffeid.TrustDomainFromString(td)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid trust domain %q: %w", p.name, td, err)
+			}
+			p.trustDomains = append(p.trustDomains, trustDomain)
+		}
+		for _, prefix := range r.PathPrefixes {
+			if !strings.HasPrefix(prefix, "/") {
+				return nil, fmt.Errorf("%s: path prefix %q must start with /", p.name, prefix)
+			}
+		}
+		for _, pattern := range r.Patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("%s: invalid pattern %q: %w", p.name, pattern, err)
+			}
+		}
+		if len(r.Expression) > 0 {
+			expr, err := compileExpression(r.Expression)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid expression %q: %w", p.name, r.Expression, err)
+			}
+			p.expression = expr
+		}
+		if len(p.ids) == 0 && len(p.trustDomains) == 0 && len(p.pathPrefixes) == 0 && len(p.patterns) == 0 && p.expression == nil {
+			return nil, fmt.Errorf("%s: rule must set at least one of ids, trust_domains, path_prefixes, patterns or expression", p.name)
+		}
+		parsed = append(parsed, p)
+	}
+	return parsed, nil
+}
+
+// Authorize decides whether the caller may call the method in the request. Calls to the gRPC
+// health service are always allowed.
+func (a *Authorizer) Authorize(req AuthorizationRequest) Decision {
+	// Health checks only reveal whether we have a valid SVID, so any caller may make them.
+	if strings.HasPrefix(req.Method, healthServicePrefix) {
+		return Decision{Allowed: true, Rule: "health check"}
+	}
+	if a.allowAll {
+		return Decision{Allowed: true, Rule: "no policy"}
+	}
+	rules, ok := a.methodRules[req.Method]
+	if !ok {
+		rules = a.defaultRules
+	}
+	for _, r := range rules {
+		if r.matches(req, a.logger) {
+			return Decision{Allowed: true, Rule: r.name}
+		}
+	}
+	if len(rules) == 0 {
+		return Decision{Allowed: false, Rule: "no rules for method"}
+	}
+	return Decision{Allowed: false, Rule: "no matching rule"}
+}
+
+func (r rule) matches(req AuthorizationRequest, logger log.Logger) bool {
+	id := req.PeerID
+	if len(r.ids) > 0 && !containsID(r.ids, id) {
+		return false
+	}
+	if len(r.trustDomains) > 0 && !memberOfAny(id, r.trustDomains) {
+		return false
+	}
+	if len(r.pathPrefixes) > 0 && !hasAnyPrefix(id.Path(), r.pathPrefixes) {
+		return false
+	}
+	if len(r.patterns) > 0 && !matchesAnyPattern(id.String(), r.patterns) {
+		return false
+	}
+	if r.expression != nil {
+		matched, err := r.expression.evaluate(req)
+		if err != nil {
+			level.Warn(logger).Log("msg", "authorization expression failed", "rule", r.name, "expression", r.expression.source, "peer_id", id, "error", err)
+		}
+		return matched
+	}
+	return true
+}
+
+func containsID(ids []spiffeid.ID, id spiffeid.ID) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+func memberOfAny(id spiffeid.ID, trustDomains []spiffeid.TrustDomain) bool {
+	for _, td := range trustDomains {
+		if id.MemberOf(td) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAnyPattern(s string, patterns []string) bool {
+	for _, pattern := range patterns {
+		// patterns were validated when the policy was loaded
+		if matched, _ := path.Match(pattern, s); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadPolicy validates the authorization policy in cfg and makes it the server's current policy.
+func (s *Server) LoadPolicy(cfg *types.ConfigFile) error {
+	commit, err := s.PreparePolicy(cfg)
+	if err != nil {
+		return err
+	}
+	commit()
+	return nil
+}
+
+// PreparePolicy validates the authorization policy in cfg, and returns a function that makes it
+// the server's current policy. It can be registered with config.AddReloadHook to apply policy
+// changes without a restart.
+func (s *Server) PreparePolicy(cfg *types.ConfigFile) (func(), error) {
+	var policy *types.AuthorizationPolicy
+	if cfg.Server != nil {
+		policy = cfg.Server.Policy
+	}
+	authorizer, err := NewAuthorizer(policy, s.logger())
+	if err != nil {
+		return nil, fmt.Errorf("invalid authorization policy: %w", err)
+	}
+	return func() { s.authorizer.Store(authorizer) }, nil
+}
+
+// authorize checks the caller in ctx against the current Authorizer.
+func (s *Server) authorize(ctx context.Context, method string) error {
+	peerID, ok := PeerIDFromContext(ctx)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "no SVID provided")
+	}
+	req := AuthorizationRequest{
+		PeerID: peerID,
+		Method: method,
+	}
+	if svid, err := config.CurrentSource.GetX509SVID(); err == nil {
+		req.ServerID = svid.ID
+	}
+	// The deny list is checked on every call too, so that it applies to connections opened
+	// before the caller was denied.
+	var decision Decision
+	if err := config.CurrentSource.CheckDenied(peerID); err != nil {
+		decision = Decision{Allowed: false, Rule: "deny list"}
+	} else {
+		decision = s.authorizer.Load().(*Authorizer).Authorize(req)
+	}
+	if info := callInfoFromContext(ctx); info != nil {
+		info.decision = &decision
+	}
+	if !decision.Allowed {
+		level.Warn(s.logger()).Log("msg", "denied call", "peer_id", peerID, "method", method, "rule", decision.Rule)
+		return status.Errorf(codes.PermissionDenied, "%s is not allowed to call %s", peerID, method)
+	}
+	return nil
+}
+
+func (s *Server) authorizeUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := s.authorize(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *Server) authorizeStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := s.authorize(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
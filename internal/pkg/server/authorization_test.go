@@ -0,0 +1,213 @@
+package server
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+
+	"github.com/jetstack/spiffe-demo/internal/pkg/testutil"
+	"github.com/jetstack/spiffe-demo/types"
+)
+
+func TestNewAuthorizerRejectsInvalidPolicies(t *testing.T) {
+	tests := map[string]struct {
+		policy  types.AuthorizationPolicy
+		wantErr string
+	}{
+		"invalid method name": {
+			policy: types.AuthorizationPolicy{Methods: map[string][]types.AuthorizationRule{
+				"HelloWorld": {{TrustDomains: []string{"example.org"}}},
+			}},
+			wantErr: `policy method "HelloWorld" is not a full gRPC method name`,
+		},
+		"invalid SPIFFE ID": {
+			policy:  types.AuthorizationPolicy{Default: []types.AuthorizationRule{{IDs: []string{"example.org/client"}}}},
+			wantErr: `default[0]: invalid SPIFFE ID "example.org/client"`,
+		},
+		"invalid trust domain": {
+			policy:  types.AuthorizationPolicy{Default: []types.AuthorizationRule{{TrustDomains: []string{"spiffe://Example.org"}}}},
+			wantErr: `default[0]: invalid trust domain "spiffe://Example.org"`,
+		},
+		"path prefix without a slash": {
+			policy:  types.AuthorizationPolicy{Default: []types.AuthorizationRule{{PathPrefixes: []string{"ns/"}}}},
+			wantErr: `default[0]: path prefix "ns/" must start with /`,
+		},
+		"invalid pattern": {
+			policy:  types.AuthorizationPolicy{Default: []types.AuthorizationRule{{Patterns: []string{"spiffe://example.org/["}}}},
+			wantErr: `default[0]: invalid pattern`,
+		},
+		"invalid expression": {
+			policy: types.AuthorizationPolicy{Methods: map[string][]types.AuthorizationRule{
+				"/SpiffeDemo/HelloWorld": {{Expression: "peer_namespace == 'a'"}},
+			}},
+			wantErr: `methods[/SpiffeDemo/HelloWorld][0]: invalid expression`,
+		},
+		"empty rule": {
+			policy:  types.AuthorizationPolicy{Default: []types.AuthorizationRule{{}}},
+			wantErr: "default[0]: rule must set at least one of",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewAuthorizer(&test.policy, log.NewNopLogger())
+			testutil.AssertError(t, err, test.wantErr)
+		})
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	policy := &types.AuthorizationPolicy{
+		Default: []types.AuthorizationRule{
+			{TrustDomains: []string{"example.org"}, PathPrefixes: []string{"/ns/batch/"}},
+		},
+		Methods: map[string][]types.AuthorizationRule{
+			"/SpiffeDemo/HelloWorld": {
+				{IDs: []string{"spiffe://example.org/ns/default/sa/client"}},
+				{Patterns: []string{"spiffe://partner.example.com/ns/*/sa/client"}},
+				{Expression: `peer_segments[1] == server_segments[1] && peer_segments[3].startsWith("batch-")`},
+			},
+			"/SpiffeDemo/WhoAmI": {},
+		},
+	}
+	authorizer, err := NewAuthorizer(policy, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serverID := spiffeid.RequireFromString("spiffe://example.org/ns/server/sa/server")
+	tests := map[string]struct {
+		peerID string
+		method string
+		want   Decision
+	}{
+		"exact ID": {
+			peerID: "spiffe://example.org/ns/default/sa/client",
+			method: "/SpiffeDemo/HelloWorld",
+			want:   Decision{Allowed: true, Rule: "methods[/SpiffeDemo/HelloWorld][0]"},
+		},
+		"pattern": {
+			peerID: "spiffe://partner.example.com/ns/shop/sa/client",
+			method: "/SpiffeDemo/HelloWorld",
+			want:   Decision{Allowed: true, Rule: "methods[/SpiffeDemo/HelloWorld][1]"},
+		},
+		"pattern doesn't match across segments": {
+			peerID: "spiffe://partner.example.com/ns/shop/extra/sa/client",
+			method: "/SpiffeDemo/HelloWorld",
+			want:   Decision{Allowed: false, Rule: "no matching rule"},
+		},
+		"expression": {
+			peerID: "spiffe://example.org/ns/server/sa/batch-job",
+			method: "/SpiffeDemo/HelloWorld",
+			want:   Decision{Allowed: true, Rule: "methods[/SpiffeDemo/HelloWorld][2]"},
+		},
+		"expression in another namespace": {
+			peerID: "spiffe://example.org/ns/other/sa/batch-job",
+			method: "/SpiffeDemo/HelloWorld",
+			want:   Decision{Allowed: false, Rule: "no matching rule"},
+		},
+		"expression that fails to evaluate": {
+			peerID: "spiffe://example.org/client",
+			method: "/SpiffeDemo/HelloWorld",
+			want:   Decision{Allowed: false, Rule: "no matching rule"},
+		},
+		"default rules for unlisted methods": {
+			peerID: "spiffe://example.org/ns/batch/sa/job",
+			method: "/SpiffeDemo/Heartbeat",
+			want:   Decision{Allowed: true, Rule: "default[0]"},
+		},
+		"every field of a rule must match": {
+			peerID: "spiffe://partner.example.com/ns/batch/sa/job",
+			method: "/SpiffeDemo/Heartbeat",
+			want:   Decision{Allowed: false, Rule: "no matching rule"},
+		},
+		"method without rules": {
+			peerID: "spiffe://example.org/ns/default/sa/client",
+			method: "/SpiffeDemo/WhoAmI",
+			want:   Decision{Allowed: false, Rule: "no rules for method"},
+		},
+		"health checks": {
+			peerID: "spiffe://partner.example.com/ns/shop/extra/sa/client",
+			method: "/grpc.health.v1.Health/Check",
+			want:   Decision{Allowed: true, Rule: "health check"},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := authorizer.Authorize(AuthorizationRequest{
+				PeerID:   spiffeid.RequireFromString(test.peerID),
+				ServerID: serverID,
+				Method:   test.method,
+			})
+			if got != test.want {
+				t.Errorf("expected %+v, got %+v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestAuthorizeWithoutPolicy(t *testing.T) {
+	authorizer, err := NewAuthorizer(nil, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := authorizer.Authorize(AuthorizationRequest{
+		PeerID: spiffeid.RequireFromString("spiffe://example.org/client"),
+		Method: "/SpiffeDemo/HelloWorld",
+	})
+	if want := (Decision{Allowed: true, Rule: "no policy"}); got != want {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestPreparePolicy(t *testing.T) {
+	s := new(Server)
+	if err := s.LoadPolicy(new(types.ConfigFile)); err != nil {
+		t.Fatal(err)
+	}
+	current := s.authorizer.Load()
+
+	_, err := s.PreparePolicy(&types.ConfigFile{Server: &types.ServerConfig{
+		Policy: &types.AuthorizationPolicy{Default: []types.AuthorizationRule{{}}},
+	}})
+	testutil.AssertError(t, err, "invalid authorization policy: default[0]")
+
+	commit, err := s.PreparePolicy(&types.ConfigFile{Server: &types.ServerConfig{
+		Policy: &types.AuthorizationPolicy{Default: []types.AuthorizationRule{{TrustDomains: []string{"example.org"}}}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.authorizer.Load() != current {
+		t.Error("expected the policy to be applied only when committed")
+	}
+	commit()
+	if s.authorizer.Load() == current {
+		t.Error("expected the committed policy to be applied")
+	}
+}
+
+func TestAuthorizeLogsExpressionErrors(t *testing.T) {
+	var logs bytes.Buffer
+	authorizer, err := NewAuthorizer(&types.AuthorizationPolicy{
+		Default: []types.AuthorizationRule{{Expression: `peer_segments[3] == "job"`}},
+	}, log.NewLogfmtLogger(&logs))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := authorizer.Authorize(AuthorizationRequest{
+		PeerID: spiffeid.RequireFromString("spiffe://example.org/client"),
+		Method: "/SpiffeDemo/HelloWorld",
+	})
+	if got.Allowed {
+		t.Errorf("expected an expression that fails to evaluate to deny the call, got %+v", got)
+	}
+	for _, want := range []string{`msg="authorization expression failed"`, "rule=default[0]", "peer_id=spiffe://example.org/client"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("expected the log to contain %s, got %q", want, logs.String())
+		}
+	}
+}
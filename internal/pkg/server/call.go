@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/spiffe/go-spiffe/v2/spiffegrpc/grpccredentials"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/jetstack/spiffe-demo/internal/pkg/tracing"
+)
+
+// callInfo is filled in by the interceptors as a call is processed, so that the outermost
+// interceptor can report on the call once it has finished.
+type callInfo struct {
+	method string
+	start  time.Time
+	peerID spiffeid.ID
+	// decision is set once the call has been checked against the authorization policy
+	decision *Decision
+}
+
+type callInfoKey struct{}
+
+func withCallInfo(ctx context.Context, method string) (context.Context, *callInfo) {
+	info := &callInfo{
+		method: method,
+		start:  time.Now(),
+	}
+	// Callers authenticated with mTLS are already known, JWT-SVID callers are filled in later.
+	if id, ok := grpccredentials.PeerIDFromContext(ctx); ok {
+		info.peerID = id
+	}
+	return context.WithValue(ctx, callInfoKey{}, info), info
+}
+
+// callInfoFromContext returns the callInfo for the current call, or nil if there is none.
+func callInfoFromContext(ctx context.Context) *callInfo {
+	info, _ := ctx.Value(callInfoKey{}).(*callInfo)
+	return info
+}
+
+// finish reports on a completed call, adding the identities involved to the call's span.
+func (s *Server) finish(ctx context.Context, info *callInfo, err error) {
+	duration := time.Since(info.start)
+	s.RPCMetrics.Observe(info.method, status.Code(err), info.peerID, duration)
+	level.Debug(s.logger()).Log("msg", "finished call", "method", info.method, "peer_id", info.peerID, "code", status.Code(err), "duration", duration)
+	p, _ := peer.FromContext(ctx)
+	tracing.Annotate(trace.SpanFromContext(ctx), info.peerID, p)
+}
+
+func (s *Server) observeUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, call := withCallInfo(ctx, info.FullMethod)
+	resp, err := handler(ctx, req)
+	s.finish(ctx, call, err)
+	return resp, err
+}
+
+func (s *Server) observeStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, call := withCallInfo(ss.Context(), info.FullMethod)
+	err := handler(srv, &wrappedStream{ServerStream: ss, ctx: ctx})
+	s.finish(ctx, call, err)
+	return err
+}
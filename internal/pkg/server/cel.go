@@ -0,0 +1,88 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+)
+
+// celEnv declares the variables available to authorization expressions:
+//
+//	peer_id, peer_trust_domain, peer_path, peer_segments    the caller's SPIFFE ID
+//	server_id, server_trust_domain, server_path, server_segments    the server's own SPIFFE ID
+//	method    the full gRPC method name, such as /SpiffeDemo/HelloWorld
+//
+// The *_segments variables are lists of strings and the others are strings, so misspelled
+// variables and comparisons between the wrong types are rejected when the policy is loaded.
+// For example, `peer_segments[1] == server_segments[1]` allows callers in the same
+// Kubernetes namespace as the server.
+var celEnv = func() *cel.Env {
+	var variables []cel.EnvOption
+	for _, prefix := range []string{"peer", "server"} {
+		variables = append(variables,
+			cel.Variable(prefix+"_id", cel.StringType),
+			cel.Variable(prefix+"_trust_domain", cel.StringType),
+			cel.Variable(prefix+"_path", cel.StringType),
+			cel.Variable(prefix+"_segments", cel.ListType(cel.StringType)),
+		)
+	}
+	env, err := cel.NewEnv(append(variables, cel.Variable("method", cel.StringType))...)
+	if err != nil {
+		panic(err)
+	}
+	return env
+}()
+
+// expression is a compiled CEL authorization expression
+type expression struct {
+	source  string
+	program cel.Program
+}
+
+// compileExpression parses and type checks a CEL expression, which must evaluate to a bool.
+// Errors include the position of the problem in the expression.
+func compileExpression(source string) (*expression, error) {
+	ast, issues := celEnv.Compile(source)
+	if issues != nil && issues.Err() != nil {
+		return nil, issues.Err()
+	}
+	if ast.OutputType() != cel.BoolType {
+		return nil, fmt.Errorf("expression must evaluate to a bool, not %s", ast.OutputType())
+	}
+	program, err := celEnv.Program(ast)
+	if err != nil {
+		return nil, err
+	}
+	return &expression{source: source, program: program}, nil
+}
+
+// evaluate reports whether the expression is true for the request. Evaluation errors, such as
+// indexing past the end of peer_segments, are returned so that they can be logged, and do not match.
+func (e *expression) evaluate(req AuthorizationRequest) (bool, error) {
+	vars := map[string]interface{}{"method": req.Method}
+	addCELIdentity(vars, "peer", req.PeerID)
+	addCELIdentity(vars, "server", req.ServerID)
+	out, _, err := e.program.Eval(vars)
+	if err != nil {
+		return false, err
+	}
+	result, ok := out.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("expression evaluated to %v, not a bool", out.Value())
+	}
+	return result, nil
+}
+
+// addCELIdentity sets the variables describing id, whose names start with prefix.
+func addCELIdentity(vars map[string]interface{}, prefix string, id spiffeid.ID) {
+	segments := []string{}
+	if p := strings.TrimPrefix(id.Path(), "/"); len(p) > 0 {
+		segments = strings.Split(p, "/")
+	}
+	vars[prefix+"_id"] = id.String()
+	vars[prefix+"_trust_domain"] = id.TrustDomain().String()
+	vars[prefix+"_path"] = id.Path()
+	vars[prefix+"_segments"] = segments
+}
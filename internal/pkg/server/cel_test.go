@@ -0,0 +1,74 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+
+	"github.com/jetstack/spiffe-demo/internal/pkg/testutil"
+)
+
+func TestCompileExpressionRejectsInvalidExpressions(t *testing.T) {
+	tests := map[string]struct {
+		expression string
+		wantErr    string
+	}{
+		"syntax error": {
+			expression: `peer_id ==`,
+			wantErr:    "<input>:1:",
+		},
+		"misspelled variable": {
+			expression: `peer_namespce == server_segments[1]`,
+			wantErr:    "<input>:1:1: undeclared reference to 'peer_namespce'",
+		},
+		"wrong type": {
+			expression: `peer_segments[1] > 3`,
+			wantErr:    "<input>:1:18: found no matching overload for '_>_'",
+		},
+		"not a bool": {
+			expression: `peer_id`,
+			wantErr:    "expression must evaluate to a bool, not string",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := compileExpression(test.expression)
+			testutil.AssertError(t, err, test.wantErr)
+		})
+	}
+}
+
+func TestEvaluateExpression(t *testing.T) {
+	req := AuthorizationRequest{
+		PeerID:   spiffeid.RequireFromString("spiffe://example.org/ns/default/sa/client"),
+		ServerID: spiffeid.RequireFromString("spiffe://example.org/ns/default/sa/server"),
+		Method:   "/SpiffeDemo/HelloWorld",
+	}
+	tests := map[string]struct {
+		expression string
+		want       bool
+		wantErr    bool
+	}{
+		"id":                 {expression: `peer_id == "spiffe://example.org/ns/default/sa/client"`, want: true},
+		"trust domain":       {expression: `peer_trust_domain == server_trust_domain`, want: true},
+		"path":               {expression: `server_path.startsWith("/ns/default/")`, want: true},
+		"segments":           {expression: `peer_segments[1] == server_segments[1] && size(peer_segments) == 4`, want: true},
+		"method":             {expression: `method == "/SpiffeDemo/WhoAmI"`, want: false},
+		"index out of range": {expression: `peer_segments[4] == "x"`, wantErr: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			expr, err := compileExpression(test.expression)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := expr.evaluate(req)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("expected error %t, got %v", test.wantErr, err)
+			}
+			if got != test.want {
+				t.Errorf("expected %t, got %t", test.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"crypto/x509"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/jetstack/spiffe-demo/internal/pkg/config"
+	"github.com/jetstack/spiffe-demo/internal/pkg/identity"
+)
+
+// connectionTracker keeps track of open connections and the certificates their peers presented,
+// so that a connection is closed once its peer's certificate is no longer valid. Otherwise a
+// connection stays trusted for as long as it is open, which for streams can be indefinitely.
+type connectionTracker struct {
+	s *Server
+
+	mu    sync.Mutex
+	conns map[*trackedConn]struct{}
+}
+
+func newConnectionTracker(s *Server) *connectionTracker {
+	return &connectionTracker{
+		s:     s,
+		conns: make(map[*trackedConn]struct{}),
+	}
+}
+
+// trackedConn is a connection whose peer presented a certificate chain.
+type trackedConn struct {
+	net.Conn
+	tracker *connectionTracker
+
+	peerID spiffeid.ID
+	chain  []*x509.Certificate
+	expiry *time.Timer
+	once   sync.Once
+}
+
+// track starts tracking conn, closing it when the earliest expiring certificate in chain expires.
+func (t *connectionTracker) track(conn net.Conn, chain []*x509.Certificate) *trackedConn {
+	tc := &trackedConn{
+		Conn:    conn,
+		tracker: t,
+		chain:   chain,
+	}
+	if id, err := x509svid.IDFromCert(chain[0]); err == nil {
+		tc.peerID = id
+	}
+
+	notAfter := chain[0].NotAfter
+	for _, cert := range chain[1:] {
+		if cert.NotAfter.Before(notAfter) {
+			notAfter = cert.NotAfter
+		}
+	}
+	// The timer is set while holding the lock, so that Close can't see it unset even if it fires immediately.
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.conns[tc] = struct{}{}
+	tc.expiry = time.AfterFunc(time.Until(notAfter), func() {
+		level.Info(t.s.logger()).Log("msg", "closing connection, peer certificate expired", "peer_id", tc.peerID, "serial", identity.SerialString(chain[0]), "not_after", notAfter, "remote_address", conn.RemoteAddr())
+		tc.Close()
+	})
+	return tc
+}
+
+// revalidate closes any connection whose peer is on the deny list. If enabled in the server config,
+// it also closes those whose certificate chain no longer verifies against the current trust
+// bundles, or has been revoked.
+func (t *connectionTracker) revalidate() {
+	serverConfig := config.GetCurrentConfig().Server
+	reverify := serverConfig != nil && serverConfig.RevalidateOnBundleChange
+
+	t.mu.Lock()
+	conns := make([]*trackedConn, 0, len(t.conns))
+	for tc := range t.conns {
+		conns = append(conns, tc)
+	}
+	t.mu.Unlock()
+
+	for _, tc := range conns {
+		err := config.CurrentSource.CheckDenied(tc.peerID)
+		if err == nil && reverify {
+			var id spiffeid.ID
+			var chains [][]*x509.Certificate
+			id, chains, err = x509svid.Verify(tc.chain, config.CurrentSource)
+			if err == nil {
+				err = config.CurrentSource.CheckRevocation(id, chains)
+			}
+		}
+		if err != nil {
+			level.Warn(t.s.logger()).Log("msg", "closing connection, peer is no longer trusted", "peer_id", tc.peerID, "serial", identity.SerialString(tc.chain[0]), "remote_address", tc.RemoteAddr(), "error", err)
+			tc.Close()
+		}
+	}
+}
+
+func (c *trackedConn) Close() error {
+	c.once.Do(func() {
+		c.tracker.mu.Lock()
+		defer c.tracker.mu.Unlock()
+		c.expiry.Stop()
+		delete(c.tracker.conns, c)
+	})
+	return c.Conn.Close()
+}
+
+// trackingCredentials tracks every connection whose peer presented a certificate.
+type trackingCredentials struct {
+	credentials.TransportCredentials
+	tracker *connectionTracker
+}
+
+func (c trackingCredentials) ServerHandshake(rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	conn, authInfo, err := c.TransportCredentials.ServerHandshake(rawConn)
+	if err != nil {
+		return conn, authInfo, err
+	}
+	chain := identity.Certificates(authInfo)
+	if len(chain) == 0 {
+		return conn, authInfo, nil
+	}
+	return c.tracker.track(conn, chain), authInfo, nil
+}
+
+func (c trackingCredentials) Clone() credentials.TransportCredentials {
+	return trackingCredentials{TransportCredentials: c.TransportCredentials.Clone(), tracker: c.tracker}
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"crypto/x509"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/jetstack/spiffe-demo/internal/pkg/config"
+	"github.com/jetstack/spiffe-demo/internal/pkg/testutil"
+	"github.com/jetstack/spiffe-demo/types"
+)
+
+// trackPipe tracks one end of a new pipe with chain, closing both ends once the test has finished.
+func trackPipe(t *testing.T, tracker *connectionTracker, chain []*x509.Certificate) *trackedConn {
+	t.Helper()
+	conn, other := net.Pipe()
+	tc := tracker.track(conn, chain)
+	t.Cleanup(func() {
+		tc.Close()
+		other.Close()
+	})
+	return tc
+}
+
+// isTracked reports whether tc is still tracked, which it stops being once it is closed.
+func isTracked(tracker *connectionTracker, tc *trackedConn) bool {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	_, ok := tracker.conns[tc]
+	return ok
+}
+
+func TestTrackClosesExpiredConnections(t *testing.T) {
+	ca := testutil.NewCA(t)
+	svid := ca.IssueSVID(t, "spiffe://example.org/client")
+	expired, _ := ca.Issue(t, &x509.Certificate{
+		URIs:      []*url.URL{svid.ID.URL()},
+		NotBefore: time.Now().Add(-2 * time.Hour),
+		NotAfter:  time.Now().Add(-time.Hour),
+	})
+
+	tests := map[string]struct {
+		chain      []*x509.Certificate
+		wantClosed bool
+	}{
+		"valid chain": {
+			chain: []*x509.Certificate{svid.Certificates[0], ca.Cert},
+		},
+		"expired leaf": {
+			chain:      []*x509.Certificate{expired, ca.Cert},
+			wantClosed: true,
+		},
+		"expired certificate later in the chain": {
+			chain:      []*x509.Certificate{svid.Certificates[0], expired},
+			wantClosed: true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			tracker := newConnectionTracker(new(Server))
+			tc := trackPipe(t, tracker, test.chain)
+			if tc.peerID != svid.ID {
+				t.Errorf("expected peer ID %s, got %s", svid.ID, tc.peerID)
+			}
+			deadline := time.Now().Add(time.Second)
+			for isTracked(tracker, tc) && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+			if closed := !isTracked(tracker, tc); closed != test.wantClosed {
+				t.Errorf("expected closed to be %t, got %t", test.wantClosed, closed)
+			}
+		})
+	}
+}
+
+func TestRevalidate(t *testing.T) {
+	ca := testutil.NewCA(t)
+	storeSource(t, ca, "spiffe://example.org/server")
+	trusted := ca.IssueSVID(t, "spiffe://example.org/trusted")
+	untrusted := testutil.NewCA(t).IssueSVID(t, "spiffe://example.org/untrusted")
+
+	tests := map[string]struct {
+		revalidate    bool
+		wantUntrusted bool
+	}{
+		"enabled": {
+			revalidate: true,
+		},
+		"disabled": {
+			wantUntrusted: true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			config.StoreConfig(&types.ConfigFile{Server: &types.ServerConfig{RevalidateOnBundleChange: test.revalidate}})
+			t.Cleanup(func() { config.StoreConfig(new(types.ConfigFile)) })
+
+			tracker := newConnectionTracker(new(Server))
+			trustedConn := trackPipe(t, tracker, trusted.Certificates)
+			untrustedConn := trackPipe(t, tracker, untrusted.Certificates)
+			tracker.revalidate()
+			if !isTracked(tracker, trustedConn) {
+				t.Error("expected the connection with a trusted certificate to stay open")
+			}
+			if isTracked(tracker, untrustedConn) != test.wantUntrusted {
+				t.Errorf("expected the connection with an untrusted certificate to be tracked: %t", test.wantUntrusted)
+			}
+		})
+	}
+}
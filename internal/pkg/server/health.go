@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/jetstack/spiffe-demo/internal/pkg/config"
+	"github.com/jetstack/spiffe-demo/internal/pkg/server/proto"
+)
+
+const (
+	// healthCheckInterval is how often the current SVID is checked to update the health status.
+	healthCheckInterval = 5 * time.Second
+	// healthServicePrefix prefixes the full method names of the gRPC health service.
+	healthServicePrefix = "/grpc.health.v1.Health/"
+)
+
+// checkSVID returns an error if there is no SVID, or if the SVID has expired or
+// does not chain to the current trust bundle for its trust domain.
+func checkSVID(svids x509svid.Source, bundles x509bundle.Source) error {
+	svid, err := svids.GetX509SVID()
+	if err != nil {
+		return err
+	}
+	if svid == nil || len(svid.Certificates) == 0 {
+		return errors.New("no SVID loaded")
+	}
+	if notAfter := svid.Certificates[0].NotAfter; time.Now().After(notAfter) {
+		return fmt.Errorf("SVID expired at %s", notAfter)
+	}
+	if _, _, err := x509svid.Verify(svid.Certificates, bundles); err != nil {
+		return fmt.Errorf("SVID does not verify against the current trust bundle: %w", err)
+	}
+	return nil
+}
+
+// watchHealth sets the serving status of the health server from the validity of the current
+// SVID, re-checking it periodically so that the status recovers once the SVID has been rotated.
+// It returns when ctx is cancelled.
+func watchHealth(ctx context.Context, logger log.Logger, healthServer *health.Server) {
+	var lastErr error
+	serving := true
+	update := func() {
+		status := healthpb.HealthCheckResponse_SERVING
+		err := checkSVID(config.CurrentSource, config.CurrentSource)
+		if err != nil {
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+			if lastErr == nil || err.Error() != lastErr.Error() {
+				level.Warn(logger).Log("msg", "not serving", "error", err)
+			}
+		} else if !serving {
+			level.Info(logger).Log("msg", "serving again, SVID is valid")
+		}
+		lastErr, serving = err, err == nil
+
+		healthServer.SetServingStatus("", status)
+		healthServer.SetServingStatus(proto.SpiffeDemo_ServiceDesc.ServiceName, status)
+	}
+
+	update()
+	t := time.NewTicker(healthCheckInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			update()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
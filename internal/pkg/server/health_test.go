@@ -0,0 +1,52 @@
+package server
+
+import (
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
+
+	"github.com/jetstack/spiffe-demo/internal/pkg/testutil"
+)
+
+func TestCheckSVID(t *testing.T) {
+	trustDomain := spiffeid.RequireTrustDomainFromString("example.org")
+	ca, otherCA := testutil.NewCA(t), testutil.NewCA(t)
+	bundle := x509bundle.FromX509Authorities(trustDomain, []*x509.Certificate{ca.Cert})
+
+	expired := ca.IssueSVID(t, "spiffe://example.org/server")
+	expired.Certificates[0].NotAfter = time.Now().Add(-time.Minute)
+
+	tests := map[string]struct {
+		svid    *x509svid.SVID
+		wantErr string
+	}{
+		"valid": {
+			svid: ca.IssueSVID(t, "spiffe://example.org/server"),
+		},
+		"no SVID": {
+			svid:    new(x509svid.SVID),
+			wantErr: "no SVID loaded",
+		},
+		"expired": {
+			svid:    expired,
+			wantErr: "SVID expired at",
+		},
+		"issued by another CA": {
+			svid:    otherCA.IssueSVID(t, "spiffe://example.org/server"),
+			wantErr: "SVID does not verify against the current trust bundle",
+		},
+		"no bundle for its trust domain": {
+			svid:    ca.IssueSVID(t, "spiffe://other.example.com/server"),
+			wantErr: "SVID does not verify against the current trust bundle",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			testutil.AssertError(t, checkSVID(test.svid, bundle), test.wantErr)
+		})
+	}
+}
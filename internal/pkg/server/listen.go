@@ -0,0 +1,99 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jetstack/spiffe-demo/types"
+)
+
+const (
+	// DefaultListenAddress is used when no listeners are configured
+	DefaultListenAddress = "[::]:9090"
+	// DefaultSocketMode is the file mode of Unix domain sockets unless configured otherwise
+	DefaultSocketMode = "0660"
+
+	unixScheme = "unix://"
+)
+
+// listen creates a net.Listener for either a TCP or a Unix domain socket address.
+func listen(l types.Listener) (net.Listener, error) {
+	if !strings.HasPrefix(l.Address, unixScheme) {
+		return net.Listen("tcp", l.Address)
+	}
+
+	path := strings.TrimPrefix(l.Address, unixScheme)
+	if len(path) == 0 {
+		return nil, fmt.Errorf("no socket path in address %q", l.Address)
+	}
+	modeString := l.SocketMode
+	if len(modeString) == 0 {
+		modeString = DefaultSocketMode
+	}
+	mode, err := strconv.ParseUint(modeString, 8, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid socket mode %q for %s: %w", modeString, l.Address, err)
+	}
+
+	// A socket left behind by a previous run that didn't shut down cleanly would stop us listening.
+	if info, err := os.Lstat(path); err == nil && info.Mode()&fs.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket %s: %w", path, err)
+		}
+	} else if err == nil {
+		return nil, fmt.Errorf("%s already exists and is not a socket", path)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	// The socket is created in a private directory and only moved into place once it has its mode,
+	// so that it is never reachable with the mode the process umask would have given it.
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".socket-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a directory for socket %s: %w", path, err)
+	}
+	defer os.RemoveAll(dir)
+	tmpPath := filepath.Join(dir, "socket")
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: tmpPath, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	// the listener would only remove the temporary path, unixListener removes the real one
+	listener.SetUnlinkOnClose(false)
+	if err := os.Chmod(tmpPath, fs.FileMode(mode)); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to set mode of socket %s: %w", path, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to move socket into place at %s: %w", path, err)
+	}
+	return &unixListener{UnixListener: listener, path: path}, nil
+}
+
+// unixListener is a Unix domain socket listener that was created at a temporary path and then
+// moved to path. It reports path as its address and removes it when closed.
+type unixListener struct {
+	*net.UnixListener
+	path      string
+	closeOnce sync.Once
+}
+
+func (l *unixListener) Addr() net.Addr {
+	return &net.UnixAddr{Name: l.path, Net: "unix"}
+}
+
+func (l *unixListener) Close() error {
+	err := l.UnixListener.Close()
+	l.closeOnce.Do(func() {
+		os.Remove(l.path)
+	})
+	return err
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jetstack/spiffe-demo/internal/pkg/testutil"
+	"github.com/jetstack/spiffe-demo/types"
+)
+
+func TestListen(t *testing.T) {
+	dir := t.TempDir()
+	stale, err := net.Listen("unix", filepath.Join(dir, "stale.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// leave the socket file behind, as a server that crashed would
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+	testutil.WriteFile(t, dir, "file", nil)
+
+	tests := map[string]struct {
+		listener types.Listener
+		wantMode fs.FileMode
+		wantErr  string
+	}{
+		"TCP": {
+			listener: types.Listener{Address: "127.0.0.1:0"},
+		},
+		"socket with the default mode": {
+			listener: types.Listener{Address: "unix://" + filepath.Join(dir, "default.sock")},
+			wantMode: 0660,
+		},
+		"socket with a configured mode": {
+			listener: types.Listener{Address: "unix://" + filepath.Join(dir, "private.sock"), SocketMode: "0600"},
+			wantMode: 0600,
+		},
+		"stale socket": {
+			listener: types.Listener{Address: "unix://" + filepath.Join(dir, "stale.sock")},
+			wantMode: 0660,
+		},
+		"existing file": {
+			listener: types.Listener{Address: "unix://" + filepath.Join(dir, "file")},
+			wantErr:  "already exists and is not a socket",
+		},
+		"invalid mode": {
+			listener: types.Listener{Address: "unix://" + filepath.Join(dir, "invalid.sock"), SocketMode: "rw-rw----"},
+			wantErr:  `invalid socket mode "rw-rw----"`,
+		},
+		"no path": {
+			listener: types.Listener{Address: "unix://"},
+			wantErr:  `no socket path in address "unix://"`,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			listener, err := listen(test.listener)
+			testutil.AssertError(t, err, test.wantErr)
+			if err != nil {
+				return
+			}
+			if test.wantMode == 0 {
+				listener.Close()
+				return
+			}
+
+			path := listener.Addr().String()
+			if "unix://"+path != test.listener.Address {
+				t.Errorf("expected the listener to report its address as %s, got %s", test.listener.Address, path)
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode()&fs.ModeSocket == 0 || info.Mode().Perm() != test.wantMode {
+				t.Errorf("expected a socket with mode %s, got %s", test.wantMode, info.Mode())
+			}
+			conn, err := net.Dial("unix", path)
+			if err != nil {
+				t.Fatalf("expected to connect to the socket: %v", err)
+			}
+			conn.Close()
+
+			listener.Close()
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("expected the socket to be removed on close, got %v", err)
+			}
+		})
+	}
+
+	// only the sockets and the file should have been created, no temporary directories
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			t.Errorf("expected no directories to be left behind, found %s", entry.Name())
+		}
+	}
+}
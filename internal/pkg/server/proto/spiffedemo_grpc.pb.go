@@ -24,6 +24,12 @@ const _ = grpc.SupportPackageIsVersion7
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type SpiffeDemoClient interface {
 	HelloWorld(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*HelloWorldResponse, error)
+	// WhoAmI returns the caller's identity as verified by the server
+	WhoAmI(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*WhoAmIResponse, error)
+	// Heartbeat sends a message at a regular interval until the caller goes away
+	Heartbeat(ctx context.Context, in *HeartbeatRequest, opts ...grpc.CallOption) (SpiffeDemo_HeartbeatClient, error)
+	// Chat replies to every message the caller sends
+	Chat(ctx context.Context, opts ...grpc.CallOption) (SpiffeDemo_ChatClient, error)
 }
 
 type spiffeDemoClient struct {
@@ -43,11 +49,89 @@ func (c *spiffeDemoClient) HelloWorld(ctx context.Context, in *emptypb.Empty, op
 	return out, nil
 }
 
+func (c *spiffeDemoClient) WhoAmI(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*WhoAmIResponse, error) {
+	out := new(WhoAmIResponse)
+	err := c.cc.Invoke(ctx, "/SpiffeDemo/WhoAmI", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *spiffeDemoClient) Heartbeat(ctx context.Context, in *HeartbeatRequest, opts ...grpc.CallOption) (SpiffeDemo_HeartbeatClient, error) {
+	stream, err := c.cc.NewStream(ctx, &SpiffeDemo_ServiceDesc.Streams[0], "/SpiffeDemo/Heartbeat", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &spiffeDemoHeartbeatClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type SpiffeDemo_HeartbeatClient interface {
+	Recv() (*HeartbeatResponse, error)
+	grpc.ClientStream
+}
+
+type spiffeDemoHeartbeatClient struct {
+	grpc.ClientStream
+}
+
+func (x *spiffeDemoHeartbeatClient) Recv() (*HeartbeatResponse, error) {
+	m := new(HeartbeatResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *spiffeDemoClient) Chat(ctx context.Context, opts ...grpc.CallOption) (SpiffeDemo_ChatClient, error) {
+	stream, err := c.cc.NewStream(ctx, &SpiffeDemo_ServiceDesc.Streams[1], "/SpiffeDemo/Chat", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &spiffeDemoChatClient{stream}
+	return x, nil
+}
+
+type SpiffeDemo_ChatClient interface {
+	Send(*ChatMessage) error
+	Recv() (*ChatMessage, error)
+	grpc.ClientStream
+}
+
+type spiffeDemoChatClient struct {
+	grpc.ClientStream
+}
+
+func (x *spiffeDemoChatClient) Send(m *ChatMessage) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *spiffeDemoChatClient) Recv() (*ChatMessage, error) {
+	m := new(ChatMessage)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // SpiffeDemoServer is the server API for SpiffeDemo service.
 // All implementations must embed UnimplementedSpiffeDemoServer
 // for forward compatibility
 type SpiffeDemoServer interface {
 	HelloWorld(context.Context, *emptypb.Empty) (*HelloWorldResponse, error)
+	// WhoAmI returns the caller's identity as verified by the server
+	WhoAmI(context.Context, *emptypb.Empty) (*WhoAmIResponse, error)
+	// Heartbeat sends a message at a regular interval until the caller goes away
+	Heartbeat(*HeartbeatRequest, SpiffeDemo_HeartbeatServer) error
+	// Chat replies to every message the caller sends
+	Chat(SpiffeDemo_ChatServer) error
 	mustEmbedUnimplementedSpiffeDemoServer()
 }
 
@@ -58,6 +142,15 @@ type UnimplementedSpiffeDemoServer struct {
 func (UnimplementedSpiffeDemoServer) HelloWorld(context.Context, *emptypb.Empty) (*HelloWorldResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method HelloWorld not implemented")
 }
+func (UnimplementedSpiffeDemoServer) WhoAmI(context.Context, *emptypb.Empty) (*WhoAmIResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method WhoAmI not implemented")
+}
+func (UnimplementedSpiffeDemoServer) Heartbeat(*HeartbeatRequest, SpiffeDemo_HeartbeatServer) error {
+	return status.Errorf(codes.Unimplemented, "method Heartbeat not implemented")
+}
+func (UnimplementedSpiffeDemoServer) Chat(SpiffeDemo_ChatServer) error {
+	return status.Errorf(codes.Unimplemented, "method Chat not implemented")
+}
 func (UnimplementedSpiffeDemoServer) mustEmbedUnimplementedSpiffeDemoServer() {}
 
 // UnsafeSpiffeDemoServer may be embedded to opt out of forward compatibility for this service.
@@ -89,6 +182,71 @@ func _SpiffeDemo_HelloWorld_Handler(srv interface{}, ctx context.Context, dec fu
 	return interceptor(ctx, in, info, handler)
 }
 
+func _SpiffeDemo_WhoAmI_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SpiffeDemoServer).WhoAmI(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/SpiffeDemo/WhoAmI",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SpiffeDemoServer).WhoAmI(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SpiffeDemo_Heartbeat_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(HeartbeatRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SpiffeDemoServer).Heartbeat(m, &spiffeDemoHeartbeatServer{stream})
+}
+
+type SpiffeDemo_HeartbeatServer interface {
+	Send(*HeartbeatResponse) error
+	grpc.ServerStream
+}
+
+type spiffeDemoHeartbeatServer struct {
+	grpc.ServerStream
+}
+
+func (x *spiffeDemoHeartbeatServer) Send(m *HeartbeatResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _SpiffeDemo_Chat_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(SpiffeDemoServer).Chat(&spiffeDemoChatServer{stream})
+}
+
+type SpiffeDemo_ChatServer interface {
+	Send(*ChatMessage) error
+	Recv() (*ChatMessage, error)
+	grpc.ServerStream
+}
+
+type spiffeDemoChatServer struct {
+	grpc.ServerStream
+}
+
+func (x *spiffeDemoChatServer) Send(m *ChatMessage) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *spiffeDemoChatServer) Recv() (*ChatMessage, error) {
+	m := new(ChatMessage)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // SpiffeDemo_ServiceDesc is the grpc.ServiceDesc for SpiffeDemo service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -100,7 +258,23 @@ var SpiffeDemo_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "HelloWorld",
 			Handler:    _SpiffeDemo_HelloWorld_Handler,
 		},
+		{
+			MethodName: "WhoAmI",
+			Handler:    _SpiffeDemo_WhoAmI_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Heartbeat",
+			Handler:       _SpiffeDemo_Heartbeat_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Chat",
+			Handler:       _SpiffeDemo_Chat_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "internal/pkg/server/proto/spiffedemo.proto",
 }
@@ -0,0 +1,254 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/jetstack/spiffe-demo/internal/pkg/metrics"
+	"github.com/jetstack/spiffe-demo/types"
+)
+
+// RetryAfterKey is the trailer sent with calls rejected by a rate limit, giving the number of
+// seconds until the caller may try again.
+const RetryAfterKey = "retry-after"
+
+// bucketSweepInterval is how often buckets that have refilled are dropped, so that callers
+// which have gone away aren't tracked forever.
+const bucketSweepInterval = time.Minute
+
+// RateLimiter enforces types.RateLimit limits with a token bucket per limit and caller. The
+// limits are validated once when the RateLimiter is constructed.
+type RateLimiter struct {
+	limits []rateLimit
+
+	mu        sync.Mutex
+	buckets   map[bucketKey]*rate.Limiter
+	lastSweep time.Time
+}
+
+// rateLimit is a validated types.RateLimit
+type rateLimit struct {
+	name         string
+	methods      map[string]struct{}
+	trustDomains []spiffeid.TrustDomain
+	patterns     []string
+	rate         rate.Limit
+	burst        int
+}
+
+type bucketKey struct {
+	limit  int
+	peerID spiffeid.ID
+}
+
+// NewRateLimiter validates limits and returns a RateLimiter enforcing them. Limit names must be
+// unique, since metrics are labelled with them.
+func NewRateLimiter(limits []types.RateLimit) (*RateLimiter, error) {
+	l := &RateLimiter{
+		buckets:   make(map[bucketKey]*rate.Limiter),
+		lastSweep: time.Now(),
+	}
+	names := make(map[string]struct{}, len(limits))
+	for i, limit := range limits {
+		p := rateLimit{
+			name:     limit.Name,
+			patterns: limit.Patterns,
+			rate:     rate.Limit(limit.Rate),
+			burst:    limit.Burst,
+		}
+		if len(p.name) == 0 {
+			p.name = fmt.Sprintf("rate_limits[%d]", i)
+		}
+		if _, duplicate := names[p.name]; duplicate {
+			return nil, fmt.Errorf("rate_limits[%d]: there is already a limit named %q", i, p.name)
+		}
+		names[p.name] = struct{}{}
+		for _, method := range limit.Methods {
+			if !strings.HasPrefix(method, "/") || strings.Count(method, "/") != 2 {
+				return nil, fmt.Errorf("%s: method %q is not a full gRPC method name such as /SpiffeDemo/HelloWorld", p.name, method)
+			}
+			if p.methods == nil {
+				p.methods = make(map[string]struct{}, len(limit.Methods))
+			}
+			p.methods[method] = struct{}{}
+		}
+		for _, td := range limit.TrustDomains {
+			trustDomain, err := spiffeid.TrustDomainFromString(td)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid trust domain %q: %w", p.name, td, err)
+			}
+			p.trustDomains = append(p.trustDomains, trustDomain)
+		}
+		for _, pattern := range limit.Patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("%s: invalid pattern %q: %w", p.name, pattern, err)
+			}
+		}
+		if limit.Rate <= 0 {
+			return nil, fmt.Errorf("%s: rate must be greater than zero", p.name)
+		}
+		if limit.Burst < 0 {
+			return nil, fmt.Errorf("%s: burst must not be negative", p.name)
+		}
+		if p.burst == 0 {
+			p.burst = int(math.Ceil(limit.Rate))
+		}
+		l.limits = append(l.limits, p)
+	}
+	return l, nil
+}
+
+// Allow takes a token from the caller's bucket for the first limit matching the call. If the
+// bucket is empty, it returns the name of the limit and how long until the call would be allowed.
+func (l *RateLimiter) Allow(peerID spiffeid.ID, method string) (ok bool, limit string, retryAfter time.Duration) {
+	for i, r := range l.limits {
+		if !r.matches(peerID, method) {
+			continue
+		}
+
+		now := time.Now()
+		l.mu.Lock()
+		l.sweep(now)
+		key := bucketKey{limit: i, peerID: peerID}
+		bucket, exists := l.buckets[key]
+		if !exists {
+			bucket = rate.NewLimiter(r.rate, r.burst)
+			l.buckets[key] = bucket
+		}
+		l.mu.Unlock()
+
+		reservation := bucket.ReserveN(now, 1)
+		if delay := reservation.DelayFrom(now); delay > 0 {
+			reservation.CancelAt(now)
+			return false, r.name, delay
+		}
+		return true, r.name, 0
+	}
+	return true, "", 0
+}
+
+// sweep drops the buckets that have refilled, which are the same as new ones. It must be called
+// with l.mu held.
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < bucketSweepInterval {
+		return
+	}
+	for key, bucket := range l.buckets {
+		if bucket.TokensAt(now) >= float64(bucket.Burst()) {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// Buckets returns the state of every caller's bucket.
+func (l *RateLimiter) Buckets() []metrics.RateLimitBucket {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	buckets := make([]metrics.RateLimitBucket, 0, len(l.buckets))
+	for key, bucket := range l.buckets {
+		buckets = append(buckets, metrics.RateLimitBucket{
+			Limit:  l.limits[key.limit].name,
+			PeerID: key.peerID,
+			Tokens: bucket.TokensAt(now),
+		})
+	}
+	return buckets
+}
+
+func (r rateLimit) matches(peerID spiffeid.ID, method string) bool {
+	if _, ok := r.methods[method]; len(r.methods) > 0 && !ok {
+		return false
+	}
+	if len(r.trustDomains) > 0 && !memberOfAny(peerID, r.trustDomains) {
+		return false
+	}
+	if len(r.patterns) > 0 && !matchesAnyPattern(peerID.String(), r.patterns) {
+		return false
+	}
+	return true
+}
+
+// LoadRateLimits validates the rate limits in cfg and makes them the server's current limits.
+func (s *Server) LoadRateLimits(cfg *types.ConfigFile) error {
+	commit, err := s.PrepareRateLimits(cfg)
+	if err != nil {
+		return err
+	}
+	commit()
+	return nil
+}
+
+// PrepareRateLimits validates the rate limits in cfg, and returns a function that makes them the
+// server's current limits. It can be registered with config.AddReloadHook to apply changes without
+// a restart, although every caller then starts again with a full bucket.
+func (s *Server) PrepareRateLimits(cfg *types.ConfigFile) (func(), error) {
+	var limits []types.RateLimit
+	if cfg.Server != nil {
+		limits = cfg.Server.RateLimits
+	}
+	limiter, err := NewRateLimiter(limits)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rate limits: %w", err)
+	}
+	return func() { s.rateLimiter.Store(limiter) }, nil
+}
+
+// RateLimitBuckets returns the state of the current RateLimiter's buckets, for metrics.
+func (s *Server) RateLimitBuckets() []metrics.RateLimitBucket {
+	limiter, ok := s.rateLimiter.Load().(*RateLimiter)
+	if !ok {
+		return nil
+	}
+	return limiter.Buckets()
+}
+
+// rateLimit checks the caller in ctx against the current RateLimiter, setting the retry-after
+// trailer if the call is rejected.
+func (s *Server) rateLimit(ctx context.Context, method string) error {
+	peerID, ok := PeerIDFromContext(ctx)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "no SVID provided")
+	}
+	allowed, limit, retryAfter := s.rateLimiter.Load().(*RateLimiter).Allow(peerID, method)
+	if allowed {
+		return nil
+	}
+
+	s.RateLimitMetrics.Limited(limit, method, peerID)
+	level.Warn(s.logger()).Log("msg", "rate limited call", "peer_id", peerID, "method", method, "limit", limit, "retry_after", retryAfter)
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if err := grpc.SetTrailer(ctx, metadata.Pairs(RetryAfterKey, strconv.Itoa(seconds))); err != nil {
+		level.Debug(s.logger()).Log("msg", "failed to set retry-after trailer", "error", err)
+	}
+	return status.Errorf(codes.ResourceExhausted, "%s has exceeded the rate limit %s for %s, retry after %ds", peerID, limit, method, seconds)
+}
+
+func (s *Server) rateLimitUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := s.rateLimit(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *Server) rateLimitStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := s.rateLimit(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
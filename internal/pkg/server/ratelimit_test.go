@@ -0,0 +1,107 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+
+	"github.com/jetstack/spiffe-demo/internal/pkg/testutil"
+	"github.com/jetstack/spiffe-demo/types"
+)
+
+func TestNewRateLimiterRejectsInvalidLimits(t *testing.T) {
+	tests := map[string]struct {
+		limits  []types.RateLimit
+		wantErr string
+	}{
+		"invalid method": {
+			limits:  []types.RateLimit{{Methods: []string{"HelloWorld"}, Rate: 1}},
+			wantErr: `rate_limits[0]: method "HelloWorld" is not a full gRPC method name`,
+		},
+		"zero rate": {
+			limits:  []types.RateLimit{{Name: "hello"}},
+			wantErr: "hello: rate must be greater than zero",
+		},
+		"negative burst": {
+			limits:  []types.RateLimit{{Rate: 1, Burst: -1}},
+			wantErr: "rate_limits[0]: burst must not be negative",
+		},
+		"duplicate names": {
+			limits:  []types.RateLimit{{Name: "hello", Rate: 1}, {Name: "hello", Rate: 2}},
+			wantErr: `rate_limits[1]: there is already a limit named "hello"`,
+		},
+		"name clashing with a default name": {
+			limits:  []types.RateLimit{{Rate: 1}, {Name: "rate_limits[0]", Rate: 2}},
+			wantErr: `rate_limits[1]: there is already a limit named "rate_limits[0]"`,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewRateLimiter(test.limits)
+			testutil.AssertError(t, err, test.wantErr)
+		})
+	}
+}
+
+func TestRateLimiterAllow(t *testing.T) {
+	limiter, err := NewRateLimiter([]types.RateLimit{
+		{Name: "partner", TrustDomains: []string{"partner.example.com"}, Rate: 0.001, Burst: 1},
+		{Name: "hello", Methods: []string{"/SpiffeDemo/HelloWorld"}, Rate: 0.001, Burst: 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := spiffeid.RequireFromString("spiffe://example.org/client")
+	partner := spiffeid.RequireFromString("spiffe://partner.example.com/client")
+
+	steps := []struct {
+		peerID    spiffeid.ID
+		method    string
+		wantOK    bool
+		wantLimit string
+	}{
+		{client, "/SpiffeDemo/HelloWorld", true, "hello"},
+		{client, "/SpiffeDemo/HelloWorld", true, "hello"},
+		{client, "/SpiffeDemo/HelloWorld", false, "hello"},
+		{client, "/SpiffeDemo/WhoAmI", true, ""},
+		// the first matching limit applies, and each caller has its own bucket
+		{partner, "/SpiffeDemo/HelloWorld", true, "partner"},
+		{partner, "/SpiffeDemo/WhoAmI", false, "partner"},
+	}
+	for i, step := range steps {
+		ok, limit, retryAfter := limiter.Allow(step.peerID, step.method)
+		if ok != step.wantOK || limit != step.wantLimit {
+			t.Errorf("call %d: expected (%t, %q), got (%t, %q)", i, step.wantOK, step.wantLimit, ok, limit)
+		}
+		if !ok && retryAfter <= 0 {
+			t.Errorf("call %d: expected a retry after duration for a limited call", i)
+		}
+	}
+}
+
+func TestPrepareRateLimits(t *testing.T) {
+	s := new(Server)
+	if err := s.LoadRateLimits(new(types.ConfigFile)); err != nil {
+		t.Fatal(err)
+	}
+	current := s.rateLimiter.Load()
+
+	_, err := s.PrepareRateLimits(&types.ConfigFile{Server: &types.ServerConfig{
+		RateLimits: []types.RateLimit{{Name: "hello"}},
+	}})
+	testutil.AssertError(t, err, "invalid rate limits: hello: rate must be greater than zero")
+
+	commit, err := s.PrepareRateLimits(&types.ConfigFile{Server: &types.ServerConfig{
+		RateLimits: []types.RateLimit{{Name: "hello", Rate: 1}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.rateLimiter.Load() != current {
+		t.Error("expected the rate limits to be applied only when committed")
+	}
+	commit()
+	if s.rateLimiter.Load() == current {
+		t.Error("expected the committed rate limits to be applied")
+	}
+}
@@ -4,46 +4,235 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
+	"io"
 	"net"
+	"sync/atomic"
+	"time"
 
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
 	"github.com/spiffe/go-spiffe/v2/spiffegrpc/grpccredentials"
 	"github.com/spiffe/go-spiffe/v2/spiffetls/tlsconfig"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
 	"google.golang.org/protobuf/types/known/emptypb"
 
 	"github.com/jetstack/spiffe-demo/internal/pkg/config"
+	"github.com/jetstack/spiffe-demo/internal/pkg/metrics"
 	"github.com/jetstack/spiffe-demo/internal/pkg/server/proto"
+	"github.com/jetstack/spiffe-demo/types"
 )
 
+// DefaultDrainTimeout is how long in-flight calls are given to finish on shutdown, unless
+// configured otherwise. It is shorter than the default Kubernetes termination grace period.
+const DefaultDrainTimeout = 20 * time.Second
+
 type Server struct {
 	proto.UnimplementedSpiffeDemoServer
+
+	// RPCMetrics records every call, if set
+	RPCMetrics *metrics.RPCMetrics
+	// Logger receives the server's logs. If nil, nothing is logged.
+	Logger log.Logger
+	// RateLimitMetrics records calls rejected by the rate limits, if set
+	RateLimitMetrics *metrics.RateLimitMetrics
+	// AuditLog receives a JSON line for every call and failed TLS handshake, if set
+	AuditLog io.Writer
+
+	authorizer  atomic.Value // *Authorizer
+	rateLimiter atomic.Value // *RateLimiter
+	// stopping is closed when the server starts shutting down, so that streams can be ended
+	// rather than waited for
+	stopping chan struct{}
 }
 
 func (s *Server) HelloWorld(ctx context.Context, empty *emptypb.Empty) (*proto.HelloWorldResponse, error) {
 	resp := &proto.HelloWorldResponse{}
 
-	clientSVID, hasSVID := grpccredentials.PeerIDFromContext(ctx)
+	clientSVID, hasSVID := PeerIDFromContext(ctx)
 	if !hasSVID {
 		return resp, errors.New("no SVID provided")
 	}
 
-	log.Println("processing message for", clientSVID.String())
+	level.Info(s.logger()).Log("msg", "processing message", "peer_id", clientSVID)
 
 	resp.Message = fmt.Sprintf("Hello %s from the server", clientSVID.String())
 
 	return resp, nil
 }
 
-func (s *Server) Start(ctx context.Context) {
-	server := grpc.NewServer(grpc.Creds(grpccredentials.MTLSServerCredentials(config.CurrentSource, config.CurrentSource, tlsconfig.AuthorizeAny())))
+// Start serves until ctx is cancelled, at which point in-flight calls are given the configured
+// drain timeout to finish before the server is stopped.
+func (s *Server) Start(ctx context.Context) error {
+	if s.authorizer.Load() == nil {
+		if err := s.LoadPolicy(config.GetCurrentConfig()); err != nil {
+			return err
+		}
+	}
+	if s.rateLimiter.Load() == nil {
+		if err := s.LoadRateLimits(config.GetCurrentConfig()); err != nil {
+			return err
+		}
+	}
+
+	// The tracing, observing and audit interceptors come first, so that they see calls rejected by the others.
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(otelgrpc.UnaryServerInterceptor(), s.observeUnary),
+		grpc.ChainStreamInterceptor(otelgrpc.StreamServerInterceptor(), s.observeStream),
+	}
+	var audit *auditor
+	if s.AuditLog != nil {
+		audit = &auditor{s: s}
+		opts = append(opts,
+			grpc.ChainUnaryInterceptor(audit.unaryInterceptor),
+			grpc.ChainStreamInterceptor(audit.streamInterceptor),
+		)
+	}
+	serverConfig := config.GetCurrentConfig().Server
+	if serverConfig != nil && serverConfig.Keepalive != nil {
+		// Connections are kept open across SVID rotations, so limiting their age bounds how long
+		// either end keeps presenting an old certificate.
+		opts = append(opts, grpc.KeepaliveParams(keepalive.ServerParameters{
+			Time:                  serverConfig.Keepalive.Time,
+			Timeout:               serverConfig.Keepalive.Timeout,
+			MaxConnectionAge:      serverConfig.Keepalive.MaxConnectionAge,
+			MaxConnectionAgeGrace: serverConfig.Keepalive.MaxConnectionAgeGrace,
+		}))
+	}
+	var creds credentials.TransportCredentials
+	if serverConfig != nil && serverConfig.Authentication.Mode == types.AuthModeJWT {
+		// Only present our own SVID, callers authenticate with a JWT-SVID instead.
+		authenticator := &jwtAuthenticator{
+			bundles:   config.CurrentSource,
+			audiences: jwtAudiences,
+			denied:    config.CurrentSource.CheckDenied,
+		}
+		creds = grpccredentials.TLSServerCredentials(config.CurrentSource)
+		opts = append(opts,
+			grpc.ChainUnaryInterceptor(authenticator.unaryInterceptor),
+			grpc.ChainStreamInterceptor(authenticator.streamInterceptor),
+		)
+	} else {
+		// Any SVID from a trusted CA may connect, the policy is enforced per method below.
+		creds = grpccredentials.MTLSServerCredentials(config.CurrentSource, config.CurrentSource, config.AuthorizeNotDenied(config.AuthorizeUnrevoked(tlsconfig.AuthorizeAny())))
+	}
+	tracker := newConnectionTracker(s)
+	config.AddBundleChangeHook(tracker.revalidate)
+	creds = trackingCredentials{TransportCredentials: creds, tracker: tracker}
+	if audit != nil {
+		creds = auditCredentials{TransportCredentials: creds, auditor: audit}
+	}
+	opts = append(opts,
+		grpc.Creds(creds),
+		grpc.ChainUnaryInterceptor(s.authorizeUnary, s.rateLimitUnary),
+		grpc.ChainStreamInterceptor(s.authorizeStream, s.rateLimitStream),
+	)
+	s.stopping = make(chan struct{})
+	server := grpc.NewServer(opts...)
 	proto.RegisterSpiffeDemoServer(server, s)
-	listener, err := net.Listen("tcp", "[::]:9090")
-	if err != nil {
-		panic("fail")
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(server, healthServer)
+	healthCtx, healthCancel := context.WithCancel(ctx)
+	defer healthCancel()
+	go watchHealth(healthCtx, s.logger(), healthServer)
+	listenerConfigs := []types.Listener{{Address: DefaultListenAddress}}
+	if serverConfig != nil && len(serverConfig.Listeners) > 0 {
+		listenerConfigs = serverConfig.Listeners
+	}
+	var listeners []net.Listener
+	for _, l := range listenerConfigs {
+		listener, err := listen(l)
+		if err != nil {
+			for _, opened := range listeners {
+				opened.Close()
+			}
+			return fmt.Errorf("failed to listen on %s: %w", l.Address, err)
+		}
+		listeners = append(listeners, listener)
+	}
+
+	// Kubernetes probes can't present an SVID, so the health service can also be served on its own
+	// without TLS. It only exposes whether the server has a valid SVID.
+	var probeServer *grpc.Server
+	if serverConfig != nil && len(serverConfig.HealthListenAddress) > 0 {
+		listener, err := listen(types.Listener{Address: serverConfig.HealthListenAddress})
+		if err != nil {
+			for _, opened := range listeners {
+				opened.Close()
+			}
+			return fmt.Errorf("failed to listen on %s: %w", serverConfig.HealthListenAddress, err)
+		}
+		probeServer = grpc.NewServer()
+		healthpb.RegisterHealthServer(probeServer, healthServer)
+		level.Info(s.logger()).Log("msg", "serving health checks", "address", serverConfig.HealthListenAddress)
+		go func() {
+			if err := probeServer.Serve(listener); err != nil {
+				level.Error(s.logger()).Log("msg", "health check server failed", "error", err)
+			}
+		}()
+		defer probeServer.Stop()
 	}
 
-	if err := server.Serve(listener); err != nil {
-		panic(err)
+	serveErr := make(chan error, len(listeners))
+	for i := range listeners {
+		level.Info(s.logger()).Log("msg", "listening", "address", listenerConfigs[i].Address)
+		go func(listener net.Listener) {
+			serveErr <- server.Serve(listener)
+		}(listeners[i])
+	}
+
+	select {
+	case err := <-serveErr:
+		// Serve only returns early on failure, in which case stop serving the other listeners too.
+		server.Stop()
+		return err
+	case <-ctx.Done():
+	}
+
+	// Report NOT_SERVING for the rest of the shutdown, so no new calls are routed to us.
+	healthServer.Shutdown()
+	close(s.stopping)
+
+	drainTimeout := DefaultDrainTimeout
+	if serverConfig := config.GetCurrentConfig().Server; serverConfig != nil && serverConfig.DrainTimeout > 0 {
+		drainTimeout = serverConfig.DrainTimeout
+	}
+	level.Info(s.logger()).Log("msg", "shutting down, waiting for in-flight calls", "drain_timeout", drainTimeout)
+
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(drainTimeout):
+		level.Warn(s.logger()).Log("msg", "drain timeout exceeded, closing remaining connections")
+		server.Stop()
+	}
+	return nil
+}
+
+func (s *Server) logger() log.Logger {
+	if s.Logger == nil {
+		return log.NewNopLogger()
+	}
+	return s.Logger
+}
+
+// jwtAudiences returns the audiences accepted in JWT-SVIDs from the current config,
+// falling back to the server's own SPIFFE ID.
+func jwtAudiences() ([]string, error) {
+	if serverConfig := config.GetCurrentConfig().Server; serverConfig != nil && len(serverConfig.Authentication.JWTAudiences) > 0 {
+		return serverConfig.Authentication.JWTAudiences, nil
+	}
+	svid, err := config.CurrentSource.GetX509SVID()
+	if err != nil {
+		return nil, err
 	}
+	return []string{svid.ID.String()}, nil
 }
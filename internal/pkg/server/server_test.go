@@ -0,0 +1,58 @@
+package server
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jetstack/spiffe-demo/internal/pkg/config"
+	"github.com/jetstack/spiffe-demo/types"
+)
+
+func TestStartStopsWhenContextIsCancelled(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "server.sock")
+	config.StoreConfig(&types.ConfigFile{Server: &types.ServerConfig{
+		Listeners: []types.Listener{{Address: "unix://" + socket}},
+	}})
+	t.Cleanup(func() { config.StoreConfig(new(types.ConfigFile)) })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := new(Server)
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- s.Start(ctx)
+	}()
+
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		conn, err := net.Dial("unix", socket)
+		if err == nil {
+			conn.Close()
+			break
+		}
+		select {
+		case err := <-stopped:
+			t.Fatalf("expected the server to keep serving, got %v", err)
+		default:
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the server to listen: %v", err)
+		}
+	}
+
+	cancel()
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Fatalf("expected a clean shutdown, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the server to stop once the context was cancelled")
+	}
+	if _, err := os.Stat(socket); !os.IsNotExist(err) {
+		t.Errorf("expected the socket to be removed, got %v", err)
+	}
+}
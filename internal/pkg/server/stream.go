@@ -0,0 +1,100 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/jetstack/spiffe-demo/internal/pkg/config"
+	"github.com/jetstack/spiffe-demo/internal/pkg/identity"
+	"github.com/jetstack/spiffe-demo/internal/pkg/server/proto"
+)
+
+// errShuttingDown ends streams when the server shuts down, so that clients reconnect elsewhere
+var errShuttingDown = status.Error(codes.Unavailable, "server is shutting down")
+
+const (
+	defaultHeartbeatInterval = 5 * time.Second
+	minHeartbeatInterval     = time.Second
+)
+
+func (s *Server) Heartbeat(req *proto.HeartbeatRequest, stream proto.SpiffeDemo_HeartbeatServer) error {
+	ctx := stream.Context()
+	peerID, ok := PeerIDFromContext(ctx)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "no SVID provided")
+	}
+
+	interval := defaultHeartbeatInterval
+	if req.Interval != nil {
+		interval = req.Interval.AsDuration()
+	}
+	if interval < minHeartbeatInterval {
+		interval = minHeartbeatInterval
+	}
+	clientSerial := identity.PeerSerialFromContext(ctx)
+	level.Info(s.logger()).Log("msg", "starting heartbeat", "peer_id", peerID, "interval", interval)
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for sequence := uint64(1); ; sequence++ {
+		err := stream.Send(&proto.HeartbeatResponse{
+			Sequence:         sequence,
+			Time:             timestamppb.Now(),
+			ServerSVIDSerial: identity.SVIDSerial(config.CurrentSource),
+			ClientSVIDSerial: clientSerial,
+		})
+		if err != nil {
+			return err
+		}
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			level.Info(s.logger()).Log("msg", "heartbeat finished", "peer_id", peerID)
+			return nil
+		case <-s.stopping:
+			return errShuttingDown
+		}
+	}
+}
+
+func (s *Server) Chat(stream proto.SpiffeDemo_ChatServer) error {
+	peerID, ok := PeerIDFromContext(stream.Context())
+	if !ok {
+		return status.Error(codes.Unauthenticated, "no SVID provided")
+	}
+	clientSerial := identity.PeerSerialFromContext(stream.Context())
+
+	for {
+		msg, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		level.Info(s.logger()).Log("msg", "chat message received", "peer_id", peerID, "text", msg.Text, "peer_serial", msg.SenderSVIDSerial)
+
+		err = stream.Send(&proto.ChatMessage{
+			Text:             fmt.Sprintf("%s said %q", peerID, msg.Text),
+			Time:             timestamppb.Now(),
+			SenderSVIDSerial: identity.SVIDSerial(config.CurrentSource),
+			PeerSVIDSerial:   clientSerial,
+		})
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-s.stopping:
+			return errShuttingDown
+		default:
+		}
+	}
+}
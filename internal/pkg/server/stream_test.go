@@ -0,0 +1,130 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+
+	"github.com/jetstack/spiffe-demo/internal/pkg/config"
+	"github.com/jetstack/spiffe-demo/internal/pkg/identity"
+	"github.com/jetstack/spiffe-demo/internal/pkg/server/proto"
+	"github.com/jetstack/spiffe-demo/internal/pkg/testutil"
+)
+
+// fakeStream is a server stream for a caller with the given certificate, receiving the messages in
+// received and recording the messages sent to it.
+type fakeStream struct {
+	grpc.ServerStream
+	ctx      context.Context
+	received []*proto.ChatMessage
+	sent     chan interface{}
+}
+
+func newFakeStream(ctx context.Context, cert *x509.Certificate) *fakeStream {
+	p := &peer.Peer{AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}}}
+	ctx = context.WithValue(peer.NewContext(ctx, p), peerIDKey{}, spiffeid.RequireFromString("spiffe://example.org/client"))
+	return &fakeStream{ctx: ctx, sent: make(chan interface{}, 10)}
+}
+
+func (f *fakeStream) Context() context.Context { return f.ctx }
+
+func (f *fakeStream) Send(msg interface{}) error {
+	f.sent <- msg
+	return nil
+}
+
+func (f *fakeStream) Recv() (*proto.ChatMessage, error) {
+	if len(f.received) == 0 {
+		return nil, io.EOF
+	}
+	msg := f.received[0]
+	f.received = f.received[1:]
+	return msg, nil
+}
+
+type heartbeatStream struct{ *fakeStream }
+
+func (h heartbeatStream) Send(resp *proto.HeartbeatResponse) error { return h.fakeStream.Send(resp) }
+
+type chatStream struct{ *fakeStream }
+
+func (c chatStream) Send(msg *proto.ChatMessage) error { return c.fakeStream.Send(msg) }
+
+func TestHeartbeat(t *testing.T) {
+	ca := testutil.NewCA(t)
+	storeSource(t, ca, "spiffe://example.org/server")
+	serverSerial := identity.SVIDSerial(config.CurrentSource)
+	clientCert, _ := ca.Issue(t, &x509.Certificate{})
+
+	tests := map[string]struct {
+		stop    func(cancel context.CancelFunc, s *Server)
+		wantErr string
+	}{
+		"caller hangs up": {
+			stop: func(cancel context.CancelFunc, _ *Server) { cancel() },
+		},
+		"server shuts down": {
+			stop:    func(_ context.CancelFunc, s *Server) { close(s.stopping) },
+			wantErr: "server is shutting down",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			s := &Server{stopping: make(chan struct{})}
+			stream := newFakeStream(ctx, clientCert)
+			done := make(chan error, 1)
+			go func() {
+				done <- s.Heartbeat(&proto.HeartbeatRequest{}, heartbeatStream{stream})
+			}()
+
+			resp := (<-stream.sent).(*proto.HeartbeatResponse)
+			if resp.Sequence != 1 || resp.ServerSVIDSerial != serverSerial || resp.ClientSVIDSerial != identity.SerialString(clientCert) {
+				t.Errorf("expected the first heartbeat to carry both serials, got %v", resp)
+			}
+
+			test.stop(cancel, s)
+			select {
+			case err := <-done:
+				testutil.AssertError(t, err, test.wantErr)
+			case <-time.After(5 * time.Second):
+				t.Fatal("expected the heartbeat to stop")
+			}
+		})
+	}
+}
+
+func TestChat(t *testing.T) {
+	ca := testutil.NewCA(t)
+	storeSource(t, ca, "spiffe://example.org/server")
+	clientCert, _ := ca.Issue(t, &x509.Certificate{})
+
+	stream := newFakeStream(context.Background(), clientCert)
+	stream.received = []*proto.ChatMessage{{Text: "hello"}, {Text: "bye"}}
+	if err := (&Server{stopping: make(chan struct{})}).Chat(chatStream{stream}); err != nil {
+		t.Fatal(err)
+	}
+
+	close(stream.sent)
+	var replies []string
+	for msg := range stream.sent {
+		reply := msg.(*proto.ChatMessage)
+		replies = append(replies, reply.Text)
+		if reply.SenderSVIDSerial != identity.SVIDSerial(config.CurrentSource) || reply.PeerSVIDSerial != identity.SerialString(clientCert) {
+			t.Errorf("expected the reply to carry both serials, got %v", reply)
+		}
+	}
+	want := []string{`spiffe://example.org/client said "hello"`, `spiffe://example.org/client said "bye"`}
+	if len(replies) != len(want) || replies[0] != want[0] || replies[1] != want[1] {
+		t.Errorf("expected replies %q, got %q", want, replies)
+	}
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"context"
+	"crypto/x509"
+	"strings"
+
+	"github.com/go-kit/log/level"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/jetstack/spiffe-demo/internal/pkg/config"
+	"github.com/jetstack/spiffe-demo/internal/pkg/identity"
+	"github.com/jetstack/spiffe-demo/internal/pkg/server/proto"
+	"github.com/jetstack/spiffe-demo/types"
+)
+
+func (s *Server) WhoAmI(ctx context.Context, empty *emptypb.Empty) (*proto.WhoAmIResponse, error) {
+	peerID, ok := PeerIDFromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "no SVID provided")
+	}
+	level.Info(s.logger()).Log("msg", "describing identity", "peer_id", peerID)
+
+	resp := &proto.WhoAmIResponse{
+		SPIFFEID:           peerID.String(),
+		TrustDomain:        peerID.TrustDomain().String(),
+		AuthenticationMode: types.AuthModeMTLS,
+	}
+	if p := strings.TrimPrefix(peerID.Path(), "/"); len(p) > 0 {
+		resp.PathSegments = strings.Split(p, "/")
+	}
+	if serverConfig := config.GetCurrentConfig().Server; serverConfig != nil && serverConfig.Authentication.Mode == types.AuthModeJWT {
+		resp.AuthenticationMode = types.AuthModeJWT
+	}
+	if svid, err := config.CurrentSource.GetX509SVID(); err == nil {
+		resp.ServerSPIFFEID = svid.ID.String()
+	}
+
+	// In JWT mode the caller doesn't present a certificate, so there's nothing more to describe.
+	p, _ := peer.FromContext(ctx)
+	cert, ok := identity.PeerCertificate(p)
+	if !ok {
+		return resp, nil
+	}
+	resp.CertificateSerial = identity.SerialString(cert)
+	resp.NotBefore = timestamppb.New(cert.NotBefore)
+	resp.NotAfter = timestamppb.New(cert.NotAfter)
+
+	// go-spiffe verifies the chain itself rather than through crypto/tls, so the connection state
+	// has no verified chains. Verifying the presented chain again against the current bundle gives
+	// the chain the handshake would have found, unless the bundle has changed since.
+	_, chains, err := x509svid.Verify(identity.PeerCertificates(p), config.CurrentSource)
+	if err != nil {
+		level.Warn(s.logger()).Log("msg", "peer certificate no longer verifies", "peer_id", peerID, "error", err)
+		return resp, nil
+	}
+	if len(chains) > 0 {
+		resp.VerifiedChain = describeChain(chains[0])
+	}
+	return resp, nil
+}
+
+func describeChain(chain []*x509.Certificate) []*proto.Certificate {
+	described := make([]*proto.Certificate, 0, len(chain))
+	for _, cert := range chain {
+		described = append(described, &proto.Certificate{
+			Subject: cert.Subject.String(),
+			Issuer:  cert.Issuer.String(),
+			Serial:  identity.SerialString(cert),
+		})
+	}
+	return described
+}
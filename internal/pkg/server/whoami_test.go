@@ -0,0 +1,112 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/jetstack/spiffe-demo/internal/pkg/config"
+	"github.com/jetstack/spiffe-demo/internal/pkg/identity"
+	"github.com/jetstack/spiffe-demo/internal/pkg/testutil"
+	"github.com/jetstack/spiffe-demo/types"
+)
+
+// storeSource makes a source with an SVID for id issued by ca, and ca's bundle, the current source
+// until the test has finished.
+func storeSource(t *testing.T, ca *testutil.CA, id string) {
+	t.Helper()
+	certs, key, err := ca.IssueSVID(t, id).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	source, err := config.ConstructSpiffeDemoSource(context.Background(), func() {}, log.NewNopLogger(), &types.SpiffeConfig{
+		SVIDSources: types.SVIDSources{InMemory: &types.InMemory{
+			TrustDomainCA: ca.CertPEM(),
+			SVIDCert:      certs,
+			SVIDKey:       key,
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.StoreCurrentSource(source)
+	t.Cleanup(func() { config.StoreCurrentSource(new(config.SpiffeDemoSource)) })
+}
+
+func TestWhoAmI(t *testing.T) {
+	ca := testutil.NewCA(t)
+	storeSource(t, ca, "spiffe://example.org/ns/server/sa/server")
+	client := ca.IssueSVID(t, "spiffe://example.org/ns/default/sa/client")
+	untrusted := testutil.NewCA(t).IssueSVID(t, "spiffe://example.org/ns/default/sa/client")
+	id := spiffeid.RequireFromString("spiffe://example.org/ns/default/sa/client")
+
+	tlsPeer := func(certs []*x509.Certificate) *peer.Peer {
+		return &peer.Peer{AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{PeerCertificates: certs}}}
+	}
+
+	tests := map[string]struct {
+		peer      *peer.Peer
+		wantCert  *x509.Certificate
+		wantChain int
+	}{
+		"X509-SVID": {
+			peer:      tlsPeer(client.Certificates),
+			wantCert:  client.Certificates[0],
+			wantChain: 2,
+		},
+		"X509-SVID that no longer verifies": {
+			peer:     tlsPeer(untrusted.Certificates),
+			wantCert: untrusted.Certificates[0],
+		},
+		"JWT-SVID": {
+			peer: &peer.Peer{},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.WithValue(peer.NewContext(context.Background(), test.peer), peerIDKey{}, id)
+			resp, err := new(Server).WhoAmI(ctx, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.SPIFFEID != id.String() || resp.TrustDomain != "example.org" || resp.ServerSPIFFEID != "spiffe://example.org/ns/server/sa/server" {
+				t.Errorf("expected the caller and server IDs, got %v", resp)
+			}
+			if want := []string{"ns", "default", "sa", "client"}; len(resp.PathSegments) != len(want) || resp.PathSegments[3] != want[3] {
+				t.Errorf("expected path segments %v, got %v", want, resp.PathSegments)
+			}
+			if resp.AuthenticationMode != types.AuthModeMTLS {
+				t.Errorf("expected the default authentication mode, got %s", resp.AuthenticationMode)
+			}
+
+			if test.wantCert == nil {
+				if len(resp.CertificateSerial) > 0 || resp.NotAfter != nil {
+					t.Errorf("expected no certificate details, got %v", resp)
+				}
+				return
+			}
+			if resp.CertificateSerial != identity.SerialString(test.wantCert) || !resp.NotAfter.AsTime().Equal(test.wantCert.NotAfter) {
+				t.Errorf("expected the details of the presented certificate, got %v", resp)
+			}
+			if len(resp.VerifiedChain) != test.wantChain {
+				t.Fatalf("expected a chain of %d certificates, got %v", test.wantChain, resp.VerifiedChain)
+			}
+			if test.wantChain > 0 && resp.VerifiedChain[1].Serial != identity.SerialString(ca.Cert) {
+				t.Errorf("expected the chain to end at the CA, got %v", resp.VerifiedChain)
+			}
+		})
+	}
+
+	_, err := new(Server).WhoAmI(context.Background(), nil)
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected an unauthenticated caller to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,44 @@
+package testutil
+
+import (
+	"crypto"
+	"testing"
+	"time"
+
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// JWTAuthority signs JWT-SVIDs for tests.
+type JWTAuthority struct {
+	KeyID string
+	Key   crypto.Signer
+}
+
+// NewJWTAuthority returns a JWT authority with a new key.
+func NewJWTAuthority(t testing.TB, keyID string) *JWTAuthority {
+	t.Helper()
+	return &JWTAuthority{KeyID: keyID, Key: newKey(t)}
+}
+
+// Sign returns a JWT-SVID token for id, valid for audience until expiry.
+func (a *JWTAuthority) Sign(t testing.TB, id string, audience []string, expiry time.Time) string {
+	t.Helper()
+	signer, err := jose.NewSigner(jose.SigningKey{
+		Algorithm: jose.ES256,
+		Key:       jose.JSONWebKey{Key: a.Key, KeyID: a.KeyID},
+	}, new(jose.SignerOptions).WithType("JWT"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := jwt.Signed(signer).Claims(jwt.Claims{
+		Subject:  id,
+		Audience: audience,
+		Expiry:   jwt.NewNumericDate(expiry),
+		IssuedAt: jwt.NewNumericDate(time.Now()),
+	}).CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
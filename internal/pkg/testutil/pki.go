@@ -0,0 +1,157 @@
+package testutil
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
+)
+
+// CA is a certificate authority issuing X509-SVIDs for tests.
+type CA struct {
+	Cert *x509.Certificate
+	Key  crypto.Signer
+}
+
+// NewCA returns a self-signed root CA.
+func NewCA(t testing.TB) *CA {
+	t.Helper()
+	key := newKey(t)
+	template := caTemplate(t)
+	return &CA{Cert: createCertificate(t, template, template, key.Public(), key), Key: key}
+}
+
+// NewIntermediate returns an intermediate CA signed by the CA.
+func (ca *CA) NewIntermediate(t testing.TB) *CA {
+	t.Helper()
+	key := newKey(t)
+	return &CA{Cert: createCertificate(t, caTemplate(t), ca.Cert, key.Public(), ca.Key), Key: key}
+}
+
+func caTemplate(t testing.TB) *x509.Certificate {
+	serial := newSerial(t)
+	return &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "test CA " + serial.Text(16)},
+		SubjectKeyId:          serial.Bytes(),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+}
+
+// Issue signs template with the CA, filling in its serial number and validity if they aren't set,
+// and returns the certificate and its key.
+func (ca *CA) Issue(t testing.TB, template *x509.Certificate) (*x509.Certificate, crypto.Signer) {
+	t.Helper()
+	if template.SerialNumber == nil {
+		template.SerialNumber = newSerial(t)
+	}
+	key := newKey(t)
+	return createCertificate(t, template, ca.Cert, key.Public(), ca.Key), key
+}
+
+// IssueSVID returns an X509-SVID for id signed by the CA.
+func (ca *CA) IssueSVID(t testing.TB, id string) *x509svid.SVID {
+	t.Helper()
+	spiffeID := spiffeid.RequireFromString(id)
+	cert, key := ca.Issue(t, &x509.Certificate{
+		URIs:     []*url.URL{spiffeID.URL()},
+		KeyUsage: x509.KeyUsageDigitalSignature,
+	})
+	return &x509svid.SVID{ID: spiffeID, Certificates: []*x509.Certificate{cert}, PrivateKey: key}
+}
+
+// CertPEM returns the CA's certificate, PEM encoded as expected in a trust bundle file.
+func (ca *CA) CertPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Cert.Raw})
+}
+
+// CRLPEM returns a PEM encoded CRL signed by the CA, revoking the given certificates. A zero
+// nextUpdate leaves the CRL without a next update time.
+func (ca *CA) CRLPEM(t testing.TB, nextUpdate time.Time, revoked ...*x509.Certificate) []byte {
+	t.Helper()
+	var entries []x509.RevocationListEntry
+	for _, cert := range revoked {
+		entries = append(entries, x509.RevocationListEntry{SerialNumber: cert.SerialNumber, RevocationTime: time.Now()})
+	}
+	thisUpdate := time.Now().Add(-time.Minute)
+	var der []byte
+	var err error
+	if nextUpdate.IsZero() {
+		// CreateRevocationList requires a next update time, unlike the deprecated CreateCRL.
+		revokedCerts := make([]pkix.RevokedCertificate, len(entries))
+		for i, entry := range entries {
+			revokedCerts[i] = pkix.RevokedCertificate{SerialNumber: entry.SerialNumber, RevocationTime: entry.RevocationTime}
+		}
+		der, err = ca.Cert.CreateCRL(rand.Reader, ca.Key, revokedCerts, thisUpdate, time.Time{})
+	} else {
+		der, err = x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+			Number:                    newSerial(t),
+			ThisUpdate:                thisUpdate,
+			NextUpdate:                nextUpdate,
+			RevokedCertificateEntries: entries,
+		}, ca.Cert, ca.Key)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der})
+}
+
+// WriteSVID writes the certificates and key of svid to PEM files in dir, and returns their paths.
+func WriteSVID(t testing.TB, dir string, svid *x509svid.SVID) (certPath, keyPath string) {
+	t.Helper()
+	certs, key, err := svid.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return WriteFile(t, dir, "svid.pem", certs), WriteFile(t, dir, "svid.key", key)
+}
+
+func newKey(t testing.TB) crypto.Signer {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func newSerial(t testing.TB) *big.Int {
+	t.Helper()
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return serial
+}
+
+func createCertificate(t testing.TB, template, parent *x509.Certificate, key crypto.PublicKey, parentKey crypto.Signer) *x509.Certificate {
+	t.Helper()
+	if template.NotBefore.IsZero() {
+		template.NotBefore = time.Now().Add(-time.Minute)
+	}
+	if template.NotAfter.IsZero() {
+		template.NotAfter = time.Now().Add(time.Hour)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
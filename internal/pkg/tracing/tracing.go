@@ -0,0 +1,86 @@
+// Package tracing sets up OpenTelemetry tracing for the SPIFFE demo server and client, and adds
+// the SPIFFE identities at each end of a call to its spans.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/peer"
+
+	"github.com/jetstack/spiffe-demo/internal/pkg/config"
+	"github.com/jetstack/spiffe-demo/internal/pkg/identity"
+	"github.com/jetstack/spiffe-demo/types"
+)
+
+// Span attributes describing the identities at each end of a call
+const (
+	LocalIDKey               = attribute.Key("spiffe.local.id")
+	PeerIDKey                = attribute.Key("spiffe.peer.id")
+	PeerCertificateSerialKey = attribute.Key("spiffe.peer.certificate.serial")
+)
+
+// Setup configures the global tracer provider to export spans as configured in cfg, and the global
+// propagator to carry trace context in gRPC metadata. The returned function flushes any remaining
+// spans and must be called before exiting. If cfg is nil or has no exporter, spans are not recorded.
+func Setup(ctx context.Context, serviceName string, cfg *types.TracingConfig) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if cfg == nil || len(cfg.Exporter) == 0 {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch cfg.Exporter {
+	case types.TraceExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case types.TraceExporterOTLP:
+		var opts []otlptracegrpc.Option
+		if len(cfg.OTLPEndpoint) > 0 {
+			opts = append(opts, otlptracegrpc.WithEndpoint(cfg.OTLPEndpoint))
+		}
+		if cfg.OTLPInsecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		exporter, err = otlptracegrpc.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q, must be %q or %q", cfg.Exporter, types.TraceExporterStdout, types.TraceExporterOTLP)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s trace exporter: %w", cfg.Exporter, err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(serviceName))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Annotate adds the SPIFFE ID of the local SVID, and the SPIFFE ID and certificate serial of the
+// peer, to span. peerID may be zero if the peer isn't known, and p may be nil.
+func Annotate(span trace.Span, peerID spiffeid.ID, p *peer.Peer) {
+	if !span.IsRecording() {
+		return
+	}
+	if svid, err := config.CurrentSource.GetX509SVID(); err == nil {
+		span.SetAttributes(LocalIDKey.String(svid.ID.String()))
+	}
+	if !peerID.IsZero() {
+		span.SetAttributes(PeerIDKey.String(peerID.String()))
+	}
+	if cert, ok := identity.PeerCertificate(p); ok {
+		span.SetAttributes(PeerCertificateSerialKey.String(identity.SerialString(cert)))
+	}
+}
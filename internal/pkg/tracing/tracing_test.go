@@ -0,0 +1,95 @@
+package tracing
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+
+	"github.com/jetstack/spiffe-demo/internal/pkg/config"
+	"github.com/jetstack/spiffe-demo/internal/pkg/testutil"
+	"github.com/jetstack/spiffe-demo/types"
+)
+
+func TestAnnotate(t *testing.T) {
+	ca := testutil.NewCA(t)
+	certs, key, err := ca.IssueSVID(t, "spiffe://example.org/server").Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	source, err := config.ConstructSpiffeDemoSource(context.Background(), func() {}, log.NewNopLogger(), &types.SpiffeConfig{
+		SVIDSources: types.SVIDSources{InMemory: &types.InMemory{
+			TrustDomainCA: ca.CertPEM(),
+			SVIDCert:      certs,
+			SVIDKey:       key,
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.StoreCurrentSource(source)
+	t.Cleanup(func() { config.StoreCurrentSource(new(config.SpiffeDemoSource)) })
+
+	clientCert, _ := ca.Issue(t, &x509.Certificate{})
+	tlsPeer := &peer.Peer{AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{PeerCertificates: []*x509.Certificate{clientCert}}}}
+
+	tests := map[string]struct {
+		peerID spiffeid.ID
+		peer   *peer.Peer
+		want   []attribute.KeyValue
+	}{
+		"mTLS peer": {
+			peerID: spiffeid.RequireFromString("spiffe://example.org/client"),
+			peer:   tlsPeer,
+			want: []attribute.KeyValue{
+				LocalIDKey.String("spiffe://example.org/server"),
+				PeerIDKey.String("spiffe://example.org/client"),
+				PeerCertificateSerialKey.String(clientCert.SerialNumber.Text(16)),
+			},
+		},
+		"JWT peer": {
+			peerID: spiffeid.RequireFromString("spiffe://example.org/client"),
+			peer:   &peer.Peer{},
+			want: []attribute.KeyValue{
+				LocalIDKey.String("spiffe://example.org/server"),
+				PeerIDKey.String("spiffe://example.org/client"),
+			},
+		},
+		"unknown peer": {
+			want: []attribute.KeyValue{
+				LocalIDKey.String("spiffe://example.org/server"),
+			},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			recorder := tracetest.NewSpanRecorder()
+			_, span := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test").Start(context.Background(), "call")
+			Annotate(span, test.peerID, test.peer)
+			span.End()
+
+			got := recorder.Ended()[0].Attributes()
+			if len(got) != len(test.want) {
+				t.Fatalf("expected attributes %v, got %v", test.want, got)
+			}
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Errorf("expected attributes %v, got %v", test.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestSetupRejectsUnknownExporters(t *testing.T) {
+	_, err := Setup(context.Background(), "test", &types.TracingConfig{Exporter: "zipkin"})
+	testutil.AssertError(t, err, `unknown trace exporter "zipkin"`)
+}
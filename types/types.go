@@ -1,14 +1,247 @@
 // Package types contains the config file structs
 package types
 
+import "time"
+
 // ConfigFile represents the config file that will be loaded from disk, or some other mechanism.
 type ConfigFile struct {
 	SPIFFE *SpiffeConfig `yaml:"spiffe"`
+	Server *ServerConfig `yaml:"server,omitempty"`
+	Client *ClientConfig `yaml:"client,omitempty"`
+	// Metrics are only read at startup
+	Metrics *MetricsConfig `yaml:"metrics,omitempty"`
+	// Tracing is only read at startup
+	Tracing *TracingConfig `yaml:"tracing,omitempty"`
+}
+
+// MetricsConfig determines whether and how Prometheus metrics are served
+type MetricsConfig struct {
+	// ListenAddress is the host:port to serve metrics on at /metrics. If empty, metrics aren't served.
+	ListenAddress string `yaml:"listen_address,omitempty"`
+	// PeerIDLabel adds the full SPIFFE ID of the peer as a label on RPC metrics. This creates
+	// a series per peer, so should only be enabled when there are few of them.
+	PeerIDLabel bool `yaml:"peer_id_label,omitempty"`
+}
+
+// Trace exporters supported by the server and client
+const (
+	// TraceExporterStdout writes spans to stdout, which is useful for debugging
+	TraceExporterStdout = "stdout"
+	// TraceExporterOTLP sends spans to an OpenTelemetry collector over gRPC
+	TraceExporterOTLP = "otlp"
+)
+
+// TracingConfig determines whether and where OpenTelemetry spans are exported
+type TracingConfig struct {
+	// Exporter is one of TraceExporterStdout or TraceExporterOTLP. If empty, tracing is disabled.
+	Exporter string `yaml:"exporter,omitempty"`
+	// OTLPEndpoint is the host:port of the collector. If empty, the OTEL_EXPORTER_OTLP_ENDPOINT
+	// environment variable or localhost:4317 is used.
+	OTLPEndpoint string `yaml:"otlp_endpoint,omitempty"`
+	// OTLPInsecure disables TLS when connecting to the collector
+	OTLPInsecure bool `yaml:"otlp_insecure,omitempty"`
+}
+
+// Authentication modes supported between the client and server
+const (
+	// AuthModeMTLS authenticates clients with their X509-SVID during the TLS handshake
+	AuthModeMTLS = "mtls"
+	// AuthModeJWT authenticates clients with a JWT-SVID bearer token sent with every RPC,
+	// so that TLS can be terminated by a proxy in between
+	AuthModeJWT = "jwt"
+)
+
+// ServerConfig represents the server section of the config file
+type ServerConfig struct {
+	// Listeners are the addresses the server listens on. If empty, it listens on [::]:9090.
+	Listeners []Listener `yaml:"listeners,omitempty"`
+	// HealthListenAddress optionally serves just the gRPC health service without TLS, for
+	// Kubernetes gRPC probes which can't present an SVID. The health service is always
+	// served on Listeners as well.
+	HealthListenAddress string               `yaml:"health_listen_address,omitempty"`
+	Authentication      ServerAuthentication `yaml:"authentication"`
+	// Policy restricts which callers may call which methods. If nil, any authenticated caller
+	// may call any method.
+	Policy *AuthorizationPolicy `yaml:"policy,omitempty"`
+	// RateLimits limit how often each caller may call each method. A call is counted against the
+	// first limit that matches it, and isn't limited if none do.
+	RateLimits []RateLimit `yaml:"rate_limits,omitempty"`
+	// DrainTimeout is how long in-flight calls are given to finish on shutdown, such as "30s".
+	DrainTimeout time.Duration `yaml:"drain_timeout,omitempty"`
+	// RevalidateOnBundleChange re-verifies the certificates presented on open connections whenever
+	// a trust bundle or CRL is reloaded, closing connections whose peer no longer chains to a
+	// trusted CA or has been revoked.
+	// Connections are always closed when the peer's certificate expires.
+	RevalidateOnBundleChange bool `yaml:"revalidate_on_bundle_change,omitempty"`
+	// Keepalive determines how long connections are kept open for. It is only read at startup.
+	Keepalive *KeepaliveConfig `yaml:"keepalive,omitempty"`
+	// Audit writes a record of every call and failed TLS handshake. It is only read at startup.
+	Audit *AuditConfig `yaml:"audit,omitempty"`
+}
+
+// KeepaliveConfig determines when the server pings clients and closes connections. Zero values
+// use gRPC's defaults.
+type KeepaliveConfig struct {
+	// Time is how long a connection is idle for before the server pings the client, defaulting to 2h.
+	Time time.Duration `yaml:"time,omitempty"`
+	// Timeout is how long the server waits for a ping to be acknowledged before closing the
+	// connection, defaulting to 20s.
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// MaxConnectionAge is how long a connection may be open for before the client is asked to
+	// reconnect, after which both ends present their current SVIDs in a new handshake. If zero,
+	// connections may be open indefinitely.
+	MaxConnectionAge time.Duration `yaml:"max_connection_age,omitempty"`
+	// MaxConnectionAgeGrace is how long calls in progress are given to finish once a connection
+	// has reached MaxConnectionAge, before it is closed. If zero, they are waited for indefinitely.
+	MaxConnectionAgeGrace time.Duration `yaml:"max_connection_age_grace,omitempty"`
+}
+
+// AuditConfig determines where the audit log is written
+type AuditConfig struct {
+	// Path is the file to append JSON Lines audit entries to, or "-" for stdout.
+	Path string `yaml:"path"`
+	// MaxSizeMB is the size in megabytes the file is rotated at, defaulting to 100.
+	MaxSizeMB int `yaml:"max_size_mb,omitempty"`
+	// MaxBackups is how many rotated files are kept. If zero, all of them are kept.
+	MaxBackups int `yaml:"max_backups,omitempty"`
+}
+
+// Listener is an address for the server to listen on.
+type Listener struct {
+	// Address is either a TCP host:port, or unix:///path/to/socket for a Unix domain socket.
+	Address string `yaml:"address"`
+	// SocketMode is the octal file mode of a Unix domain socket, such as "0660", which is the default.
+	SocketMode string `yaml:"socket_mode,omitempty"`
+}
+
+// ServerAuthentication determines how the server authenticates its callers.
+type ServerAuthentication struct {
+	// Mode is one of AuthModeMTLS or AuthModeJWT, defaulting to AuthModeMTLS.
+	Mode string `yaml:"mode,omitempty"`
+	// JWTAudiences are the audiences accepted in JWT-SVIDs. If empty, the server's own SPIFFE ID is
+	// the only accepted audience.
+	JWTAudiences []string `yaml:"jwt_audiences,omitempty"`
+}
+
+// AuthorizationPolicy determines which callers are allowed to call each gRPC method.
+// A caller is allowed if it matches any of the rules for the method.
+type AuthorizationPolicy struct {
+	// Default rules apply to methods that are not listed in Methods. If there are none, calls
+	// to unlisted methods are denied.
+	Default []AuthorizationRule `yaml:"default,omitempty"`
+	// Methods maps full gRPC method names, such as /SpiffeDemo/HelloWorld, to their rules.
+	Methods map[string][]AuthorizationRule `yaml:"methods,omitempty"`
+}
+
+// AuthorizationRule matches a caller's SPIFFE ID. Every field that is set must match, and
+// a field matches if any of its values match.
+type AuthorizationRule struct {
+	// IDs are exact SPIFFE IDs.
+	IDs []string `yaml:"ids,omitempty"`
+	// TrustDomains are trust domains the ID must be a member of.
+	TrustDomains []string `yaml:"trust_domains,omitempty"`
+	// PathPrefixes are prefixes of the ID's path, such as /ns/example-client/.
+	PathPrefixes []string `yaml:"path_prefixes,omitempty"`
+	// Patterns are globs matched against the full ID, such as spiffe://example.org/ns/*/sa/client.
+	// A * does not match across path segments.
+	Patterns []string `yaml:"patterns,omitempty"`
+	// Expression is a CEL expression that must evaluate to true, such as
+	// `peer_segments[1] == server_segments[1] && peer_segments[3].startsWith("batch-")`.
+	// See the server package for the available variables.
+	Expression string `yaml:"expression,omitempty"`
+}
+
+// RateLimit limits how often each caller matching it may call the matching methods. Every caller
+// has its own token bucket, shared between the limit's methods. Fields that are empty match
+// anything, and a field matches if any of its values match.
+type RateLimit struct {
+	// Name identifies the limit in logs and metrics, defaulting to rate_limits[<index>]. Names must
+	// be unique.
+	Name string `yaml:"name,omitempty"`
+	// Methods are full gRPC method names, such as /SpiffeDemo/HelloWorld.
+	Methods []string `yaml:"methods,omitempty"`
+	// TrustDomains are trust domains the caller's ID must be a member of.
+	TrustDomains []string `yaml:"trust_domains,omitempty"`
+	// Patterns are globs matched against the caller's full ID, as in AuthorizationRule.
+	Patterns []string `yaml:"patterns,omitempty"`
+	// Rate is how many calls per second each caller may make on average.
+	Rate float64 `yaml:"rate"`
+	// Burst is how many calls each caller may make at once, defaulting to Rate rounded up.
+	Burst int `yaml:"burst,omitempty"`
+}
+
+// ClientConfig represents the client section of the config file
+type ClientConfig struct {
+	Authentication ClientAuthentication `yaml:"authentication"`
+	// ServerAuthorization determines which servers the client accepts. If it is empty, the
+	// --server-spiffe-id and related flags are used instead.
+	ServerAuthorization ServerAuthorization `yaml:"server_authorization,omitempty"`
+	// ReconnectOnRotation re-dials the server whenever our X509-SVID changes, so that the server
+	// sees the new certificate straight away. It is only read at startup.
+	ReconnectOnRotation bool `yaml:"reconnect_on_rotation,omitempty"`
+	// Retry determines how often the server is called and how failed calls are retried. It is
+	// only read at startup.
+	Retry *RetryConfig `yaml:"retry,omitempty"`
+}
+
+// RetryConfig determines how often the client calls the server, and how failed calls are retried.
+// Zero values use the defaults in the client package.
+type RetryConfig struct {
+	// Interval is how long the client waits between successful calls, defaulting to 1s.
+	Interval time.Duration `yaml:"interval,omitempty"`
+	// Timeout is how long each call may take including all of its attempts, defaulting to 1m.
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// MaxAttempts is how many times a call is attempted when the server is unavailable, including
+	// the first attempt, defaulting to 3. gRPC allows at most 5, and 1 disables retries.
+	MaxAttempts int `yaml:"max_attempts,omitempty"`
+	// InitialBackoff is the longest the client waits before the first retry, defaulting to 1s.
+	// gRPC waits for a random duration up to the backoff between attempts.
+	InitialBackoff time.Duration `yaml:"initial_backoff,omitempty"`
+	// MaxBackoff caps the backoff between attempts, and between calls after failures, defaulting to 30s.
+	MaxBackoff time.Duration `yaml:"max_backoff,omitempty"`
+	// BackoffMultiplier is what the backoff is multiplied by after every failure, defaulting to 2.
+	BackoffMultiplier float64 `yaml:"backoff_multiplier,omitempty"`
+	// MaxConsecutiveFailures is how many calls in a row may fail before the client exits with a
+	// non-zero status, so that it is restarted. If zero, the client never gives up.
+	MaxConsecutiveFailures int `yaml:"max_consecutive_failures,omitempty"`
+}
+
+// ServerAuthorization matches the SPIFFE ID presented by the server. Every field that is set must
+// match, and a field matches if any of its values match.
+type ServerAuthorization struct {
+	// IDs are exact SPIFFE IDs.
+	IDs []string `yaml:"ids,omitempty"`
+	// TrustDomains are trust domains the ID must be a member of.
+	TrustDomains []string `yaml:"trust_domains,omitempty"`
+	// PathPrefixes are prefixes of the ID's path, such as /ns/example-server/.
+	PathPrefixes []string `yaml:"path_prefixes,omitempty"`
+	// Regex is a regular expression that must match the whole ID, such as
+	// spiffe://example\.org/ns/[^/]+/sa/server-.*
+	Regex string `yaml:"regex,omitempty"`
+}
+
+// ClientAuthentication determines how the client authenticates itself to the server.
+type ClientAuthentication struct {
+	// Mode is one of AuthModeMTLS or AuthModeJWT, defaulting to AuthModeMTLS.
+	Mode string `yaml:"mode,omitempty"`
+	// JWTAudience is the audience requested for JWT-SVIDs. If empty, the server's SPIFFE ID is used.
+	JWTAudience string `yaml:"jwt_audience,omitempty"`
 }
 
 // SpiffeConfig represents the SPIFFE configuration section of spiffe-connector's config file
 type SpiffeConfig struct {
 	SVIDSources SVIDSources `yaml:"svid_sources"`
+	// DenyList is the path of a DenyList file, which is reloaded whenever it changes.
+	DenyList string `yaml:"deny_list,omitempty"`
+}
+
+// DenyList is a file listing SPIFFE IDs that are rejected even though they have a valid SVID,
+// such as those of compromised workloads.
+type DenyList struct {
+	// IDs are exact SPIFFE IDs.
+	IDs []string `yaml:"ids,omitempty"`
+	// PathPrefixes are prefixes of the ID's path in any trust domain, such as /ns/compromised/.
+	PathPrefixes []string `yaml:"path_prefixes,omitempty"`
 }
 
 // SVIDSources determines where spiffe-connector will obtain its own SVID and trust domain information.
@@ -26,14 +259,36 @@ type WorkloadAPI struct {
 }
 
 type Files struct {
-	TrustDomainCA string `yaml:"trust_domain_ca"`
-	SVIDCert      string `yaml:"svid_cert"`
-	SVIDKey       string `yaml:"svid_key"`
+	// TrustDomain is the trust domain that TrustDomainCA is the bundle for.
+	// If empty, the trust domain of the current SVID is used, following it if a rotated SVID moves.
+	TrustDomain string `yaml:"trust_domain,omitempty"`
+	// TrustDomainCA is the path of the trust bundle, either as PEM encoded certificates
+	// or in the SPIFFE bundle (JWKS) format.
+	TrustDomainCA string `yaml:"trust_domain_ca,omitempty"`
+	// FederatedTrustDomainCAs maps other trust domains to the path of their trust bundle,
+	// so that SVIDs from federated trust domains can be verified.
+	FederatedTrustDomainCAs map[string]string `yaml:"federated_trust_domain_cas,omitempty"`
+	// CRLs are the paths of PEM or DER encoded certificate revocation lists issued by the CAs
+	// of TrustDomain. Peers presenting a revoked certificate, or one issued by a revoked
+	// intermediate, are rejected. CRLs don't apply to callers authenticating with a JWT-SVID.
+	CRLs []string `yaml:"crls,omitempty"`
+	// FederatedCRLs maps federated trust domains to the paths of their CRLs.
+	FederatedCRLs map[string][]string `yaml:"federated_crls,omitempty"`
+	SVIDCert      string              `yaml:"svid_cert"`
+	SVIDKey       string              `yaml:"svid_key"`
+	// JWTSVID is the path of a JWT-SVID token to present to others.
+	JWTSVID string `yaml:"jwt_svid,omitempty"`
+	// JWTBundle is the path of a JWKS containing the JWT authorities of the trust domain.
+	// If set, it takes precedence over any JWT authorities in TrustDomainCA.
+	JWTBundle string `yaml:"jwt_bundle,omitempty"`
 }
 
 // InMemory is only used in testing
 type InMemory struct {
+	TrustDomain   string
 	TrustDomainCA []byte
 	SVIDCert      []byte
 	SVIDKey       []byte
+	JWTSVID       string
+	JWTBundle     []byte
 }